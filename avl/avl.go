@@ -5,35 +5,54 @@ References:
 	- https://www.cise.ufl.edu/~nemo/cop3530/AVL-Tree-Rotations.pdf
 	- https://github.com/cmuparlay/PAM
 	- https://github.com/canepat/balanced-search-tree
+
+Trees are persistent: every operation copies the paths it changes and shares the untouched subtrees with its inputs,
+so the input trees remain valid versions after any operation.
+
+The algorithms are generic over the key and value types and take a Comparator ordering the keys. Node and the functions
+working on it are the byte slice instantiation ordered by bytes.Compare, Tree wraps any other instantiation.
 */
 
 package avl
 
 import (
 	"bytes"
-	"fmt"
 )
 
-type Node struct {
-	Key    []byte
-	Left   *Node
-	Right  *Node
+// TreeNode is a node of a tree with keys of type K and values of type V
+type TreeNode[K any, V any] struct {
+	Key    K
+	Value  V
+	Left   *TreeNode[K, V]
+	Right  *TreeNode[K, V]
 	Height int
 	Path   string
 }
 
+// Node is a node of a tree with byte slice keys and values
+type Node = TreeNode[[]byte, []byte]
+
+// Comparator orders keys, it returns -1, 0 or 1 when a is smaller than, equal to or greater than b
+type Comparator[K any] func(a K, b K) int
+
 // NewNode is a custom constructor method to initialise height of the node
-func NewNode(key []byte, left, right *Node) *Node {
-	node := new(Node)
+// Nodes are never modified once created, so the children are shared and their heights are trusted
+func NewNode(key []byte, value []byte, left, right *Node) *Node {
+	return newTreeNode(key, value, left, right)
+}
+
+func newTreeNode[K any, V any](key K, value V, left, right *TreeNode[K, V]) *TreeNode[K, V] {
+	node := new(TreeNode[K, V])
 	node.Key = key
+	node.Value = value
 	node.Left = left
 	node.Right = right
-	node.Height = getHeight(node)
+	node.Height = heightFromChildren(left, right)
 	return node
 }
 
 // PopulatePaths attaches node paths from the root of a node down to the node
-func (n *Node) PopulatePaths(path string) {
+func (n *TreeNode[K, V]) PopulatePaths(path string) {
 	n.Path = path
 	if n.Left != nil {
 		n.Left.PopulatePaths(path + "L")
@@ -46,80 +65,54 @@ func (n *Node) PopulatePaths(path string) {
 // HeightOf Get height of a node
 // This function exists because the join method can take a null Node pointer
 // and accessing the height property of a null Node pointer will fail
-func HeightOf(node *Node) int {
+func HeightOf[K any, V any](node *TreeNode[K, V]) int {
 	if node == nil {
 		return -1
 	}
 	return node.Height
 }
 
-// getHeight sets the height of a node with respect to its children, returns the current node's height
-func getHeight(tree *Node) int {
-	var height int
-	if tree.Left != nil && tree.Right != nil {
-		height = MaxInt(getHeight(tree.Left), getHeight(tree.Right)) + 1
-	} else if tree.Left != nil {
-		height = getHeight(tree.Left) + 1
-	} else if tree.Right != nil {
-		height = getHeight(tree.Right) + 1
-	}
-	tree.Height = height
-	return height
-}
-
-// updateHeight sets the height of a node with respect to its children, returns nothing
-func updateHeight(tree *Node) {
-	var leftHeight int
-	var rightHeight int
-	if tree.Left != nil {
-		leftHeight = tree.Left.Height
-	}
-	if tree.Right != nil {
-		rightHeight = tree.Right.Height
-	}
-	tree.Height = MaxInt(leftHeight, rightHeight) + 1
+// heightFromChildren returns the height of a node with respect to the heights of its children
+func heightFromChildren[K any, V any](left *TreeNode[K, V], right *TreeNode[K, V]) int {
+	return MaxInt(HeightOf(left), HeightOf(right)) + 1
 }
 
-// expose returns key of a node and it's left and right children
-func expose(tree *Node) (tree1 *Node, k []byte, tree2 *Node) {
+// expose returns key and value of a node and it's left and right children
+func expose[K any, V any](tree *TreeNode[K, V]) (tree1 *TreeNode[K, V], k K, v V, tree2 *TreeNode[K, V]) {
 	if tree != nil {
-		return tree.Left, tree.Key, tree.Right
+		return tree.Left, tree.Key, tree.Value, tree.Right
 	}
-	return nil, []byte{}, nil
+	return nil, k, v, nil
 }
 
 // rotateRight rotates a node to the right to maintain the AVL balance criteria
-func rotateRight(tree *Node) *Node {
-	newRoot := tree.Left
-	tree.Left = newRoot.Right
-	newRoot.Right = tree
-	updateHeight(newRoot.Right)
-	updateHeight(newRoot)
-	return newRoot
+// The two nodes on the rotated path are copied, the input tree is left untouched
+func rotateRight[K any, V any](tree *TreeNode[K, V]) *TreeNode[K, V] {
+	l, k, v, r := expose(tree)
+	ll, lk, lv, lr := expose(l)
+	return newTreeNode(lk, lv, ll, newTreeNode(k, v, lr, r))
 }
 
 // rotateLeft rotates a node to the left to maintain the AVL balance criteria
-func rotateLeft(tree *Node) *Node {
-	newRoot := tree.Right
-	tree.Right = newRoot.Left
-	newRoot.Left = tree
-	updateHeight(newRoot.Left)
-	updateHeight(newRoot)
-	return newRoot
+// The two nodes on the rotated path are copied, the input tree is left untouched
+func rotateLeft[K any, V any](tree *TreeNode[K, V]) *TreeNode[K, V] {
+	l, k, v, r := expose(tree)
+	rl, rk, rv, rr := expose(r)
+	return newTreeNode(rk, rv, newTreeNode(k, v, l, rl), rr)
 }
 
 // joinRight concatenates a left tree, k and a right tree
-func joinRight(tree1 *Node, k []byte, tree2 *Node) *Node {
-	l, kPrime, c := expose(tree1)
+func joinRight[K any, V any](tree1 *TreeNode[K, V], k K, v V, tree2 *TreeNode[K, V]) *TreeNode[K, V] {
+	l, kPrime, vPrime, c := expose(tree1)
 	if HeightOf(c) <= HeightOf(tree2)+1 {
-		treePrime := NewNode(k, c, tree2)
+		treePrime := newTreeNode(k, v, c, tree2)
 		if HeightOf(treePrime) <= HeightOf(l)+1 {
-			return NewNode(kPrime, l, treePrime)
+			return newTreeNode(kPrime, vPrime, l, treePrime)
 		}
-		return rotateLeft(NewNode(kPrime, l, rotateRight(treePrime)))
+		return rotateLeft(newTreeNode(kPrime, vPrime, l, rotateRight(treePrime)))
 	}
-	treePrime := joinRight(c, k, tree2)
-	treePrimePrime := NewNode(kPrime, l, treePrime)
+	treePrime := joinRight(c, k, v, tree2)
+	treePrimePrime := newTreeNode(kPrime, vPrime, l, treePrime)
 	if HeightOf(treePrime) <= HeightOf(l)+1 {
 		return treePrimePrime
 	}
@@ -127,17 +120,17 @@ func joinRight(tree1 *Node, k []byte, tree2 *Node) *Node {
 }
 
 // joinLeft concatenates a left tree, k and a right tree
-func joinLeft(tree1 *Node, k []byte, tree2 *Node) *Node {
-	c, kPrime, r := expose(tree2)
+func joinLeft[K any, V any](tree1 *TreeNode[K, V], k K, v V, tree2 *TreeNode[K, V]) *TreeNode[K, V] {
+	c, kPrime, vPrime, r := expose(tree2)
 	if HeightOf(c) <= HeightOf(tree1)+1 {
-		treePrime := NewNode(k, tree1, c)
+		treePrime := newTreeNode(k, v, tree1, c)
 		if HeightOf(treePrime) <= HeightOf(r)+1 {
-			return NewNode(kPrime, treePrime, r)
+			return newTreeNode(kPrime, vPrime, treePrime, r)
 		}
-		return rotateRight(NewNode(kPrime, rotateLeft(treePrime), r))
+		return rotateRight(newTreeNode(kPrime, vPrime, rotateLeft(treePrime), r))
 	}
-	treePrime := joinLeft(tree1, k, c)
-	treePrimePrime := NewNode(kPrime, treePrime, r)
+	treePrime := joinLeft(tree1, k, v, c)
+	treePrimePrime := newTreeNode(kPrime, vPrime, treePrime, r)
 	if HeightOf(treePrime) <= HeightOf(r)+1 {
 		return treePrimePrime
 	}
@@ -145,90 +138,237 @@ func joinLeft(tree1 *Node, k []byte, tree2 *Node) *Node {
 }
 
 // join concatenates a left tree, k and a right tree
-func join(tree1 *Node, k []byte, tree2 *Node) *Node {
+func join[K any, V any](tree1 *TreeNode[K, V], k K, v V, tree2 *TreeNode[K, V]) *TreeNode[K, V] {
 	if HeightOf(tree1) > HeightOf(tree2)+1 {
-		return joinRight(tree1, k, tree2)
+		return joinRight(tree1, k, v, tree2)
 	} else if HeightOf(tree2) > HeightOf(tree1)+1 {
-		return joinLeft(tree1, k, tree2)
+		return joinLeft(tree1, k, v, tree2)
 	}
-	return NewNode(k, tree1, tree2)
+	return newTreeNode(k, v, tree1, tree2)
 }
 
-// split separates a tree into two distinct trees at value k
-func split(tree *Node, k []byte) (*Node, bool, *Node) {
+// split separates a tree into two distinct trees at value k, returns whether k was in the tree and its value
+func split[K any, V any](tree *TreeNode[K, V], k K, cmp Comparator[K]) (*TreeNode[K, V], bool, V, *TreeNode[K, V]) {
 	if tree == nil {
-		return nil, false, nil
+		var v V
+		return nil, false, v, nil
 	}
-	l, m, r := expose(tree)
-	if bytes.Compare(k, m) == 0 {
-		return l, true, r
+	l, m, v, r := expose(tree)
+	if cmp(k, m) == 0 {
+		return l, true, v, r
 	}
-	if bytes.Compare(k, m) == -1 {
-		ll, b, lr := split(l, k)
-		fmt.Println(ll, lr)
-		return ll, b, join(lr, m, r)
+	if cmp(k, m) == -1 {
+		ll, b, bv, lr := split(l, k, cmp)
+		return ll, b, bv, join(lr, m, v, r)
 	}
-	rl, b, rr := split(r, k)
-	return join(l, m, rl), b, rr
+	rl, b, bv, rr := split(r, k, cmp)
+	return join(l, m, v, rl), b, bv, rr
 }
 
 // splitLast separates a tree into two distinct trees at the rightmost node
-func splitLast(tree *Node) (*Node, []byte) {
-	l, k, r := expose(tree)
+func splitLast[K any, V any](tree *TreeNode[K, V]) (*TreeNode[K, V], K, V) {
+	l, k, v, r := expose(tree)
 	if r == nil {
-		return l, k
+		return l, k, v
 	}
-	treePrime, kPrime := splitLast(r)
-	return join(l, k, treePrime), kPrime
+	treePrime, kPrime, vPrime := splitLast(r)
+	return join(l, k, v, treePrime), kPrime, vPrime
 }
 
 // join2 concatenates a left tree and a right tree
-func join2(tree1 *Node, tree2 *Node) *Node {
+func join2[K any, V any](tree1 *TreeNode[K, V], tree2 *TreeNode[K, V]) *TreeNode[K, V] {
 	if tree1 == nil {
 		return tree2
 	}
-	tree1Prime, k := splitLast(tree1)
-	return join(tree1Prime, k, tree2)
+	tree1Prime, k, v := splitLast(tree1)
+	return join(tree1Prime, k, v, tree2)
 }
 
-// Insert inserts a node into a tree
-func Insert(tree *Node, k []byte) *Node {
-	tree1, _, tree2 := split(tree, k)
-	return join(tree1, k, tree2)
+func put[K any, V any](tree *TreeNode[K, V], k K, v V, cmp Comparator[K]) *TreeNode[K, V] {
+	tree1, _, _, tree2 := split(tree, k, cmp)
+	return join(tree1, k, v, tree2)
+}
+
+func get[K any, V any](tree *TreeNode[K, V], k K, cmp Comparator[K]) (V, bool) {
+	for tree != nil {
+		switch cmp(k, tree.Key) {
+		case 0:
+			return tree.Value, true
+		case -1:
+			tree = tree.Left
+		default:
+			tree = tree.Right
+		}
+	}
+	var v V
+	return v, false
 }
 
-// deleteNode deletes a node from a tree
-func deleteNode(tree *Node, k []byte) *Node {
-	tree1, _, tree2 := split(tree, k)
+func remove[K any, V any](tree *TreeNode[K, V], k K, cmp Comparator[K]) *TreeNode[K, V] {
+	tree1, _, _, tree2 := split(tree, k, cmp)
 	return join2(tree1, tree2)
 }
 
-// Union carries out the union operation on two trees
+// Insert inserts a key with no value into a tree
+func Insert(tree *Node, k []byte) *Node {
+	return Put(tree, k, nil)
+}
+
+// Put inserts a key into a tree, or replaces its value if it is already there
+func Put(tree *Node, k []byte, v []byte) *Node {
+	return put(tree, k, v, bytes.Compare)
+}
+
+// Get returns the value of a key and whether it is in the tree
+func Get(tree *Node, k []byte) ([]byte, bool) {
+	return get(tree, k, bytes.Compare)
+}
+
+// Delete deletes a key from a tree
+func Delete(tree *Node, k []byte) *Node {
+	return remove(tree, k, bytes.Compare)
+}
+
+// MergeFunc combines the values a key has in the left and right trees of a union
+type MergeFunc func(key []byte, left []byte, right []byte) []byte
+
+// LeftWins keeps the value of the left tree
+func LeftWins(_ []byte, left []byte, _ []byte) []byte {
+	return left
+}
+
+// RightWins keeps the value of the right tree
+func RightWins(_ []byte, _ []byte, right []byte) []byte {
+	return right
+}
+
+// Union carries out the union operation on two trees, the right tree wins for keys in both, like an upsert
 func Union(tree1 *Node, tree2 *Node) *Node {
+	return union(tree1, tree2, bytes.Compare, RightWins, 0)
+}
+
+// UnionWith carries out the union operation on two trees, combining the values of keys in both with merge
+func UnionWith(tree1 *Node, tree2 *Node, merge MergeFunc) *Node {
+	return union(tree1, tree2, bytes.Compare, merge, 0)
+}
+
+// ParallelUnion carries out the union operation on two trees, forking the recursive calls on goroutines
+// while the second tree is at least cutoff high
+func ParallelUnion(tree1 *Node, tree2 *Node, cutoff int) *Node {
+	return union(tree1, tree2, bytes.Compare, RightWins, cutoff)
+}
+
+func union[K any, V any](tree1 *TreeNode[K, V], tree2 *TreeNode[K, V], cmp Comparator[K], merge func(K, V, V) V, cutoff int) *TreeNode[K, V] {
 	if tree1 == nil {
 		return tree2
 	}
 	if tree2 == nil {
 		return tree1
 	}
-	l2, k2, r2 := expose(tree2)
-	l1, _, r1 := split(tree1, k2)
-	treeLeft := Union(l1, l2)
-	treeRight := Union(r1, r2)
-	return join(treeLeft, k2, treeRight)
+	l2, k2, v2, r2 := expose(tree2)
+	l1, b, v1, r1 := split(tree1, k2, cmp)
+	treeLeft, treeRight := fork(tree2, cutoff, func() *TreeNode[K, V] {
+		return union(l1, l2, cmp, merge, cutoff)
+	}, func() *TreeNode[K, V] {
+		return union(r1, r2, cmp, merge, cutoff)
+	})
+	if b {
+		v2 = merge(k2, v1, v2)
+	}
+	return join(treeLeft, k2, v2, treeRight)
 }
 
 // Difference carries out the difference operation on two trees
 func Difference(tree1 *Node, tree2 *Node) *Node {
+	return difference(tree1, tree2, bytes.Compare, 0)
+}
+
+// ParallelDifference carries out the difference operation on two trees, forking the recursive calls on goroutines
+// while the second tree is at least cutoff high
+func ParallelDifference(tree1 *Node, tree2 *Node, cutoff int) *Node {
+	return difference(tree1, tree2, bytes.Compare, cutoff)
+}
+
+func difference[K any, V any](tree1 *TreeNode[K, V], tree2 *TreeNode[K, V], cmp Comparator[K], cutoff int) *TreeNode[K, V] {
 	if tree1 == nil {
 		return nil
 	}
 	if tree2 == nil {
 		return tree1
 	}
-	l2, k2, r2 := expose(tree2)
-	l1, _, r1 := split(tree1, k2)
-	tree1 = Difference(l1, l2)
-	tree2 = Difference(r1, r2)
+	l2, k2, _, r2 := expose(tree2)
+	l1, _, _, r1 := split(tree1, k2, cmp)
+	tree1, tree2 = fork(tree2, cutoff, func() *TreeNode[K, V] {
+		return difference(l1, l2, cmp, cutoff)
+	}, func() *TreeNode[K, V] {
+		return difference(r1, r2, cmp, cutoff)
+	})
 	return join2(tree1, tree2)
 }
+
+// fork runs the recursive calls of a bulk operation, the left one on a new goroutine when the tree is at least cutoff high
+// The operations never modify existing nodes, so the calls can run concurrently on shared trees
+// A cutoff of 0 or less never forks
+func fork[K any, V any](tree *TreeNode[K, V], cutoff int, left func() *TreeNode[K, V], right func() *TreeNode[K, V]) (*TreeNode[K, V], *TreeNode[K, V]) {
+	if cutoff <= 0 || HeightOf(tree) < cutoff {
+		return left(), right()
+	}
+	var treeLeft *TreeNode[K, V]
+	var p interface{}
+	done := make(chan struct{})
+	go func() {
+		// A panic is handed back to the calling goroutine, where it can be recovered
+		defer func() {
+			p = recover()
+			close(done)
+		}()
+		treeLeft = left()
+	}()
+	treeRight := right()
+	<-done
+	if p != nil {
+		panic(p)
+	}
+	return treeLeft, treeRight
+}
+
+// Intersection carries out the intersection operation on two trees, keeping the values of the left tree
+func Intersection(tree1 *Node, tree2 *Node) *Node {
+	return intersection(tree1, tree2, bytes.Compare)
+}
+
+func intersection[K any, V any](tree1 *TreeNode[K, V], tree2 *TreeNode[K, V], cmp Comparator[K]) *TreeNode[K, V] {
+	if tree1 == nil || tree2 == nil {
+		return nil
+	}
+	l2, k2, _, r2 := expose(tree2)
+	l1, b, v1, r1 := split(tree1, k2, cmp)
+	treeLeft := intersection(l1, l2, cmp)
+	treeRight := intersection(r1, r2, cmp)
+	if b {
+		return join(treeLeft, k2, v1, treeRight)
+	}
+	return join2(treeLeft, treeRight)
+}
+
+// SymmetricDifference carries out the symmetric difference operation on two trees
+func SymmetricDifference(tree1 *Node, tree2 *Node) *Node {
+	return symmetricDifference(tree1, tree2, bytes.Compare)
+}
+
+func symmetricDifference[K any, V any](tree1 *TreeNode[K, V], tree2 *TreeNode[K, V], cmp Comparator[K]) *TreeNode[K, V] {
+	if tree1 == nil {
+		return tree2
+	}
+	if tree2 == nil {
+		return tree1
+	}
+	l2, k2, v2, r2 := expose(tree2)
+	l1, b, _, r1 := split(tree1, k2, cmp)
+	treeLeft := symmetricDifference(l1, l2, cmp)
+	treeRight := symmetricDifference(r1, r2, cmp)
+	if b {
+		return join2(treeLeft, treeRight)
+	}
+	return join(treeLeft, k2, v2, treeRight)
+}
@@ -1,6 +1,7 @@
 package avl
 
 import (
+	"bytes"
 	"testing"
 )
 
@@ -115,3 +116,301 @@ func FuzzDifference(f *testing.F) {
 		}
 	})
 }
+
+func FuzzIntersection(f *testing.F) {
+	f.Add([]byte{1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15, 16, 17, 18, 19, 20})
+
+	f.Fuzz(func(t *testing.T, b []byte) {
+		temp1, temp2 := SplitByteArray(&b)
+
+		// Each input is embedded on its own so that the two trees can share keys
+		b1 := make([][]byte, 0)
+		if temp1 != nil {
+			set := make(map[string]bool)
+			b1 = *(EmbedByteArray(*temp1, &set))
+		}
+
+		b2 := make([][]byte, 0)
+		if temp2 != nil {
+			set := make(map[string]bool)
+			b2 = *(EmbedByteArray(*temp2, &set))
+		}
+
+		// The reference result is the set of keys present in both inputs
+		in2 := make(map[string]bool)
+		for _, key := range b2 {
+			in2[string(key)] = true
+		}
+		expected := make(map[string]bool)
+		for _, key := range b1 {
+			if in2[string(key)] {
+				expected[string(key)] = true
+			}
+		}
+
+		t1 := CreateTree(&b1)
+		t2 := CreateTree(&b2)
+
+		tI := Intersection(t1, t2)
+
+		keys := *(GetInorderTraversal(tI))
+		if len(keys) != len(expected) {
+			t.Fatalf("tI has %v keys, expected %v", len(keys), len(expected))
+		}
+		for _, key := range keys {
+			if !expected[string(key)] {
+				t.Fatalf("Key: %v in tI not in both t1 and t2", key)
+			}
+		}
+
+		// Check that tI is balanced
+		if !IsBalanced(tI) {
+			t.Fatalf("tI with root: %v is height unbalanced", tI)
+		}
+
+		// Check that tI is a valid BST
+		if !IsValidBST(tI) {
+			t.Fatalf("tI with root: %v is not a valid BST", tI)
+		}
+	})
+}
+
+func FuzzSymmetricDifference(f *testing.F) {
+	f.Add([]byte{1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15, 16, 17, 18, 19, 20})
+
+	f.Fuzz(func(t *testing.T, b []byte) {
+		temp1, temp2 := SplitByteArray(&b)
+
+		// Each input is embedded on its own so that the two trees can share keys
+		b1 := make([][]byte, 0)
+		if temp1 != nil {
+			set := make(map[string]bool)
+			b1 = *(EmbedByteArray(*temp1, &set))
+		}
+
+		b2 := make([][]byte, 0)
+		if temp2 != nil {
+			set := make(map[string]bool)
+			b2 = *(EmbedByteArray(*temp2, &set))
+		}
+
+		// The reference result is the set of keys present in exactly one of the inputs
+		expected := make(map[string]bool)
+		for _, key := range append(append([][]byte{}, b1...), b2...) {
+			expected[string(key)] = !expected[string(key)]
+		}
+		size := 0
+		for _, in := range expected {
+			if in {
+				size++
+			}
+		}
+
+		t1 := CreateTree(&b1)
+		t2 := CreateTree(&b2)
+
+		tS := SymmetricDifference(t1, t2)
+
+		keys := *(GetInorderTraversal(tS))
+		if len(keys) != size {
+			t.Fatalf("tS has %v keys, expected %v", len(keys), size)
+		}
+		for _, key := range keys {
+			if !expected[string(key)] {
+				t.Fatalf("Key: %v in tS is in both t1 and t2", key)
+			}
+		}
+
+		// Check that tS is balanced
+		if !IsBalanced(tS) {
+			t.Fatalf("tS with root: %v is height unbalanced", tS)
+		}
+
+		// Check that tS is a valid BST
+		if !IsValidBST(tS) {
+			t.Fatalf("tS with root: %v is not a valid BST", tS)
+		}
+	})
+}
+
+func TestParallelOperationsMatchSequential(t *testing.T) {
+	b := make([]byte, 0, 4000)
+	for i := 0; i < 2000; i++ {
+		b = append(b, byte(i*7919>>8), byte(i*7919))
+	}
+
+	operations := []struct {
+		name       string
+		sequential func(*Node, *Node) *Node
+		parallel   func(*Node, *Node, int) *Node
+	}{
+		{"union", Union, ParallelUnion},
+		{"difference", Difference, ParallelDifference},
+	}
+
+	for _, operation := range operations {
+		set := make(map[string]bool)
+		temp1, temp2 := SplitByteArray(&b)
+		t1 := CreateTree(EmbedByteArray(*temp2, &set))
+		t2 := CreateTree(EmbedByteArray(*temp1, &set))
+		expected := *(GetInorderTraversal(operation.sequential(t1, t2)))
+
+		for _, cutoff := range []int{0, 1, 4} {
+			T := operation.parallel(t1, t2, cutoff)
+			keys := *(GetInorderTraversal(T))
+
+			if len(keys) != len(expected) {
+				t.Fatalf("%s with cutoff %v has %v keys, expected %v", operation.name, cutoff, len(keys), len(expected))
+			}
+			for i := range keys {
+				if !bytes.Equal(keys[i], expected[i]) {
+					t.Fatalf("%s with cutoff %v has key %v where %v was expected", operation.name, cutoff, keys[i], expected[i])
+				}
+			}
+			if !IsBalanced(T) || !IsValidBST(T) {
+				t.Fatalf("%s with cutoff %v is not a balanced BST", operation.name, cutoff)
+			}
+		}
+	}
+}
+
+// snapshot records the key, height and children of every node of a tree
+func snapshot(root *Node, nodes map[*Node]Node) {
+	if root == nil {
+		return
+	}
+	nodes[root] = *root
+	snapshot(root.Left, nodes)
+	snapshot(root.Right, nodes)
+}
+
+func FuzzOperationsKeepInputs(f *testing.F) {
+	f.Add([]byte{1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15, 16, 17, 18, 19, 20})
+
+	f.Fuzz(func(t *testing.T, b []byte) {
+		temp1, temp2 := SplitByteArray(&b)
+		if temp1 == nil {
+			return
+		}
+		set1 := make(map[string]bool)
+		set2 := make(map[string]bool)
+		t1 := CreateTree(EmbedByteArray(*temp1, &set1))
+		t2 := CreateTree(EmbedByteArray(*temp2, &set2))
+
+		before := make(map[*Node]Node)
+		snapshot(t1, before)
+		snapshot(t2, before)
+
+		Union(t1, t2)
+		Difference(t1, t2)
+		Intersection(t1, t2)
+		SymmetricDifference(t1, t2)
+		Insert(t1, []byte{0})
+		Delete(t1, t1.Key)
+		Put(t1, t1.Key, []byte{1})
+
+		after := make(map[*Node]Node)
+		snapshot(t1, after)
+		snapshot(t2, after)
+		if len(after) != len(before) {
+			t.Fatalf("the inputs went from %v nodes to %v", len(before), len(after))
+		}
+		for node, fields := range before {
+			if after[node].Left != fields.Left || after[node].Right != fields.Right || after[node].Height != fields.Height ||
+				!bytes.Equal(after[node].Value, fields.Value) {
+				t.Fatalf("Key: %v was modified by an operation", fields.Key)
+			}
+		}
+	})
+}
+
+func TestGetPutDelete(t *testing.T) {
+	reference := make(map[string][]byte)
+	var tree *Node
+	for i := 0; i < 500; i++ {
+		k := []byte{byte(i * 37 % 101)}
+		switch i % 3 {
+		case 0, 1:
+			tree = Put(tree, k, []byte{byte(i)})
+			reference[string(k)] = []byte{byte(i)}
+		case 2:
+			tree = Delete(tree, k)
+			delete(reference, string(k))
+		}
+
+		for j := 0; j < 101; j++ {
+			v, ok := Get(tree, []byte{byte(j)})
+			expected, in := reference[string([]byte{byte(j)})]
+			if ok != in || !bytes.Equal(v, expected) {
+				t.Fatalf("Key: %v has value %v, %v in the tree, expected %v, %v", j, v, ok, expected, in)
+			}
+		}
+		if !IsBalanced(tree) || !IsValidBST(tree) {
+			t.Fatalf("tree is not a balanced BST after %v updates", i+1)
+		}
+	}
+}
+
+func FuzzUnionWith(f *testing.F) {
+	f.Add([]byte{1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15, 16, 17, 18, 19, 20})
+
+	f.Fuzz(func(t *testing.T, b []byte) {
+		temp1, temp2 := SplitByteArray(&b)
+		if temp1 == nil {
+			return
+		}
+
+		// Keys come with a value of their own in each tree, and both trees can share keys
+		var t1, t2 *Node
+		left := make(map[string][]byte)
+		right := make(map[string][]byte)
+		for i := 0; i+1 < len(*temp1); i += 2 {
+			t1 = Put(t1, (*temp1)[i:i+1], (*temp1)[i+1:i+2])
+			left[string((*temp1)[i:i+1])] = (*temp1)[i+1 : i+2]
+		}
+		for i := 0; i+1 < len(*temp2); i += 2 {
+			t2 = Put(t2, (*temp2)[i:i+1], (*temp2)[i+1:i+2])
+			right[string((*temp2)[i:i+1])] = (*temp2)[i+1 : i+2]
+		}
+
+		concat := func(_ []byte, l []byte, r []byte) []byte {
+			return append(append([]byte{}, l...), r...)
+		}
+		policies := []struct {
+			name  string
+			merge MergeFunc
+		}{
+			{"left wins", LeftWins},
+			{"right wins", RightWins},
+			{"concatenation", concat},
+		}
+
+		for _, policy := range policies {
+			// The reference result is the union of the maps, merging the values of shared keys
+			expected := make(map[string][]byte)
+			for k, v := range left {
+				expected[k] = v
+			}
+			for k, v := range right {
+				if l, ok := expected[k]; ok {
+					v = policy.merge([]byte(k), l, v)
+				}
+				expected[k] = v
+			}
+
+			tU := UnionWith(t1, t2, policy.merge)
+			keys := *(GetInorderTraversal(tU))
+			if len(keys) != len(expected) {
+				t.Fatalf("%s: tU has %v keys, expected %v", policy.name, len(keys), len(expected))
+			}
+			for k, v := range expected {
+				if got, ok := Get(tU, []byte(k)); !ok || !bytes.Equal(got, v) {
+					t.Fatalf("%s: Key: %v has value %v, expected %v", policy.name, []byte(k), got, v)
+				}
+			}
+			if !IsBalanced(tU) || !IsValidBST(tU) {
+				t.Fatalf("%s: tU is not a balanced BST", policy.name)
+			}
+		}
+	})
+}
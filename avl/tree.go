@@ -0,0 +1,119 @@
+package avl
+
+// Ordered is the set of types ordered by the < operator
+type Ordered interface {
+	~int | ~int8 | ~int16 | ~int32 | ~int64 |
+		~uint | ~uint8 | ~uint16 | ~uint32 | ~uint64 | ~uintptr |
+		~float32 | ~float64 | ~string
+}
+
+// Compare is the Comparator of the ordered types
+func Compare[K Ordered](a K, b K) int {
+	if a < b {
+		return -1
+	}
+	if a > b {
+		return 1
+	}
+	return 0
+}
+
+// Tree is a persistent tree with keys of type K ordered by a Comparator and values of type V
+// Every update returns a new version of the tree and leaves the receiver untouched. The bulk operations expect
+// both trees to be ordered by the same comparator
+type Tree[K any, V any] struct {
+	root *TreeNode[K, V]
+	cmp  Comparator[K]
+}
+
+// NewTree is a custom constructor method to initialise an empty tree ordered by cmp
+func NewTree[K any, V any](cmp Comparator[K]) *Tree[K, V] {
+	return &Tree[K, V]{cmp: cmp}
+}
+
+// with returns a version of the tree with another root
+func (t *Tree[K, V]) with(root *TreeNode[K, V]) *Tree[K, V] {
+	return &Tree[K, V]{root: root, cmp: t.cmp}
+}
+
+// Root returns the root node of the tree, nil for an empty tree
+func (t *Tree[K, V]) Root() *TreeNode[K, V] {
+	return t.root
+}
+
+// Len returns the number of keys of the tree
+func (t *Tree[K, V]) Len() int {
+	count := 0
+	t.Ascend(func(K, V) bool {
+		count++
+		return true
+	})
+	return count
+}
+
+// Ascend calls fn on every key and value in order until it returns false
+func (t *Tree[K, V]) Ascend(fn func(k K, v V) bool) {
+	ascend(t.root, fn)
+}
+
+func ascend[K any, V any](root *TreeNode[K, V], fn func(k K, v V) bool) bool {
+	if root == nil {
+		return true
+	}
+	return ascend(root.Left, fn) && fn(root.Key, root.Value) && ascend(root.Right, fn)
+}
+
+// Get returns the value of a key and whether it is in the tree
+func (t *Tree[K, V]) Get(k K) (V, bool) {
+	return get(t.root, k, t.cmp)
+}
+
+// Put inserts a key into the tree, or replaces its value if it is already there
+func (t *Tree[K, V]) Put(k K, v V) *Tree[K, V] {
+	return t.with(put(t.root, k, v, t.cmp))
+}
+
+// Delete deletes a key from the tree
+func (t *Tree[K, V]) Delete(k K) *Tree[K, V] {
+	return t.with(remove(t.root, k, t.cmp))
+}
+
+// Union carries out the union operation on two trees, the other tree wins for keys in both
+func (t *Tree[K, V]) Union(other *Tree[K, V]) *Tree[K, V] {
+	return t.with(union(t.root, other.root, t.cmp, rightWins[K, V], 0))
+}
+
+// UnionWith carries out the union operation on two trees, combining the values of keys in both with merge
+func (t *Tree[K, V]) UnionWith(other *Tree[K, V], merge func(k K, left V, right V) V) *Tree[K, V] {
+	return t.with(union(t.root, other.root, t.cmp, merge, 0))
+}
+
+// ParallelUnion is Union with the recursive calls forked on goroutines while the other tree is at least cutoff high
+func (t *Tree[K, V]) ParallelUnion(other *Tree[K, V], cutoff int) *Tree[K, V] {
+	return t.with(union(t.root, other.root, t.cmp, rightWins[K, V], cutoff))
+}
+
+// Difference carries out the difference operation on two trees
+func (t *Tree[K, V]) Difference(other *Tree[K, V]) *Tree[K, V] {
+	return t.with(difference(t.root, other.root, t.cmp, 0))
+}
+
+// ParallelDifference is Difference with the recursive calls forked on goroutines while the other tree is at least cutoff high
+func (t *Tree[K, V]) ParallelDifference(other *Tree[K, V], cutoff int) *Tree[K, V] {
+	return t.with(difference(t.root, other.root, t.cmp, cutoff))
+}
+
+// Intersection carries out the intersection operation on two trees, keeping the values of the receiver
+func (t *Tree[K, V]) Intersection(other *Tree[K, V]) *Tree[K, V] {
+	return t.with(intersection(t.root, other.root, t.cmp))
+}
+
+// SymmetricDifference carries out the symmetric difference operation on two trees
+func (t *Tree[K, V]) SymmetricDifference(other *Tree[K, V]) *Tree[K, V] {
+	return t.with(symmetricDifference(t.root, other.root, t.cmp))
+}
+
+// rightWins keeps the value of the right tree for any key and value types
+func rightWins[K any, V any](_ K, _ V, right V) V {
+	return right
+}
@@ -0,0 +1,211 @@
+package avl
+
+import (
+	"bytes"
+	"testing"
+)
+
+func FuzzTree(f *testing.F) {
+	f.Add([]byte{1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15, 16, 17, 18, 19, 20})
+
+	f.Fuzz(func(t *testing.T, b []byte) {
+		temp1, temp2 := SplitByteArray(&b)
+		if temp1 == nil {
+			return
+		}
+
+		// Keys are uint64 built from pairs of bytes, so that both trees can share keys
+		tree1 := NewTree[uint64, int](Compare[uint64])
+		tree2 := NewTree[uint64, int](Compare[uint64])
+		left := make(map[uint64]int)
+		right := make(map[uint64]int)
+		for i := 0; i+1 < len(*temp1); i += 2 {
+			k := uint64((*temp1)[i])<<40 | uint64((*temp1)[i+1])
+			tree1 = tree1.Put(k, i)
+			left[k] = i
+		}
+		for i := 0; i+1 < len(*temp2); i += 2 {
+			k := uint64((*temp2)[i])<<40 | uint64((*temp2)[i+1])
+			tree2 = tree2.Put(k, -i)
+			right[k] = -i
+		}
+
+		union := make(map[uint64]int)
+		difference := make(map[uint64]int)
+		intersection := make(map[uint64]int)
+		symmetricDifference := make(map[uint64]int)
+		for k, v := range left {
+			union[k] = v
+			if _, ok := right[k]; ok {
+				intersection[k] = v
+			} else {
+				difference[k] = v
+				symmetricDifference[k] = v
+			}
+		}
+		for k, v := range right {
+			union[k] = v
+			if _, ok := left[k]; !ok {
+				symmetricDifference[k] = v
+			}
+		}
+
+		results := []struct {
+			name     string
+			tree     *Tree[uint64, int]
+			expected map[uint64]int
+		}{
+			{"union", tree1.Union(tree2), union},
+			{"parallel union", tree1.ParallelUnion(tree2, 1), union},
+			{"difference", tree1.Difference(tree2), difference},
+			{"parallel difference", tree1.ParallelDifference(tree2, 1), difference},
+			{"intersection", tree1.Intersection(tree2), intersection},
+			{"symmetric difference", tree1.SymmetricDifference(tree2), symmetricDifference},
+		}
+
+		for _, result := range results {
+			if result.tree.Len() != len(result.expected) {
+				t.Fatalf("%s has %v keys, expected %v", result.name, result.tree.Len(), len(result.expected))
+			}
+			previous, first := uint64(0), true
+			result.tree.Ascend(func(k uint64, v int) bool {
+				if !first && k <= previous {
+					t.Fatalf("%s: Key: %v comes after %v", result.name, k, previous)
+				}
+				if expected, ok := result.expected[k]; !ok || v != expected {
+					t.Fatalf("%s: Key: %v has value %v, expected %v", result.name, k, v, expected)
+				}
+				previous, first = k, false
+				return true
+			})
+		}
+
+		// The inputs are left untouched
+		if tree1.Len() != len(left) || tree2.Len() != len(right) {
+			t.Fatalf("the bulk operations modified their inputs")
+		}
+	})
+}
+
+// account is a composite key ordered by address then storage slot
+type account struct {
+	address string
+	slot    uint64
+}
+
+func compareAccounts(a account, b account) int {
+	if c := Compare(a.address, b.address); c != 0 {
+		return c
+	}
+	return Compare(a.slot, b.slot)
+}
+
+func TestTreeWithCompositeKeys(t *testing.T) {
+	state := NewTree[account, string](compareAccounts)
+	for _, address := range []string{"0xb", "0xa", "0xc"} {
+		for slot := uint64(3); slot > 0; slot-- {
+			state = state.Put(account{address, slot}, address)
+		}
+	}
+	updates := NewTree[account, string](compareAccounts).
+		Put(account{"0xa", 2}, "updated").
+		Put(account{"0xd", 1}, "new")
+
+	concat := func(_ account, left string, right string) string {
+		return left + "+" + right
+	}
+	merged := state.UnionWith(updates, concat)
+
+	if v, ok := merged.Get(account{"0xa", 2}); !ok || v != "0xa+updated" {
+		t.Fatalf("merged value is %v, %v", v, ok)
+	}
+	if v, _ := state.Get(account{"0xa", 2}); v != "0xa" {
+		t.Fatalf("the union modified the original state")
+	}
+
+	var keys []account
+	merged.Ascend(func(k account, _ string) bool {
+		keys = append(keys, k)
+		return true
+	})
+	if len(keys) != 10 || keys[0] != (account{"0xa", 1}) || keys[9] != (account{"0xd", 1}) {
+		t.Fatalf("keys are out of order: %v", keys)
+	}
+
+	if merged.Delete(account{"0xd", 1}).Len() != 9 {
+		t.Fatalf("delete did not remove the key")
+	}
+}
+
+func TestByteTreeMatchesNodeFunctions(t *testing.T) {
+	tree := NewTree[[]byte, []byte](bytes.Compare)
+	var root *Node
+	for i := 0; i < 100; i++ {
+		k := []byte{byte(i * 37 % 101)}
+		tree = tree.Put(k, []byte{byte(i)})
+		root = Put(root, k, []byte{byte(i)})
+	}
+
+	expected := *(GetInorderTraversal(root))
+	i := 0
+	tree.Ascend(func(k []byte, v []byte) bool {
+		if !bytes.Equal(k, expected[i]) {
+			t.Fatalf("key %v of the tree is %v, %v in the node functions", i, k, expected[i])
+		}
+		if w, _ := Get(root, k); !bytes.Equal(v, w) {
+			t.Fatalf("Key: %v has value %v in the tree and %v in the node functions", k, v, w)
+		}
+		i++
+		return true
+	})
+	if !IsBalanced(tree.Root()) || !IsValidBST(tree.Root()) {
+		t.Fatalf("the tree is not a balanced BST")
+	}
+}
+
+func TestParallelUnionHandsBackPanics(t *testing.T) {
+	// The comparator panics on the smallest key once armed, which the union only compares on a forked goroutine
+	armed := false
+	cmp := func(a uint64, b uint64) int {
+		if armed && (a == 0 || b == 0) {
+			panic("comparing the smallest key")
+		}
+		return Compare(a, b)
+	}
+	tree1 := NewTree[uint64, int](cmp)
+	tree2 := NewTree[uint64, int](cmp)
+	for k := uint64(0); k < 1000; k++ {
+		tree1 = tree1.Put(2*k+1, 1)
+		tree2 = tree2.Put(2*k, 2)
+	}
+	armed = true
+
+	defer func() {
+		if r := recover(); r != "comparing the smallest key" {
+			t.Fatalf("the parallel union panicked with %v", r)
+		}
+	}()
+	tree1.ParallelUnion(tree2, 1)
+	t.Fatalf("the parallel union did not panic")
+}
+
+func BenchmarkParallelUnion(b *testing.B) {
+	// Run with several -cpu values, such as -cpu 1,2,4, to compare the sequential and parallel unions
+	tree1 := NewTree[uint64, int](Compare[uint64])
+	tree2 := NewTree[uint64, int](Compare[uint64])
+	for k := uint64(0); k < 1<<16; k++ {
+		tree1 = tree1.Put(k*7919%(1<<20), 1)
+		tree2 = tree2.Put(k*104729%(1<<20), 2)
+	}
+
+	b.Run("sequential", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			tree1.Union(tree2)
+		}
+	})
+	b.Run("parallel", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			tree1.ParallelUnion(tree2, 8)
+		}
+	})
+}
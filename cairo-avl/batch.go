@@ -0,0 +1,292 @@
+package cairo_avl
+
+import (
+	"bytes"
+	"sort"
+)
+
+// BatchBuilder collects the records of a batch in any order and builds the DictNode applying them
+// Records are deduplicated per key and per nested key, the last record wins
+type BatchBuilder struct {
+	entries map[string]*batchEntry
+}
+
+// batchEntry is the surviving state of the records of one key
+type batchEntry struct {
+	key    []byte
+	value  []byte
+	op     Op
+	nested map[string]*nestedRecord
+}
+
+// nestedRecord is the last record of a key of a nested tree
+type nestedRecord struct {
+	key     []byte
+	value   []byte
+	deleted bool
+}
+
+// NewBatchBuilder is a custom constructor method to initialise an empty BatchBuilder
+func NewBatchBuilder() *BatchBuilder {
+	return &BatchBuilder{entries: make(map[string]*batchEntry)}
+}
+
+// entry returns the entry of a key to write to, a new one upserting it when the key has no record yet
+func (b *BatchBuilder) entry(key []byte) *batchEntry {
+	e, ok := b.entries[string(key)]
+	if !ok {
+		e = &batchEntry{key: key, nested: make(map[string]*nestedRecord)}
+		b.entries[string(key)] = e
+	}
+	return e
+}
+
+// upsert returns the entry of a key to put to, a key deleted earlier in the batch is replaced along with its nested tree
+func (b *BatchBuilder) upsert(key []byte) *batchEntry {
+	e := b.entry(key)
+	if e.op == OpDelete {
+		e.op = OpReplace
+	}
+	return e
+}
+
+// Put upserts a key with a value, keeping the nested records of the key
+func (b *BatchBuilder) Put(key []byte, value []byte) {
+	b.upsert(key).value = value
+}
+
+// Delete deletes a key along with its nested tree, dropping the earlier records of the key
+func (b *BatchBuilder) Delete(key []byte) {
+	e := b.entry(key)
+	e.value = nil
+	e.op = OpDelete
+	e.nested = make(map[string]*nestedRecord)
+}
+
+// NestedPut upserts a subkey with a value in the nested tree of a key, the key keeps its value unless it is also put
+func (b *BatchBuilder) NestedPut(key []byte, subkey []byte, value []byte) {
+	b.upsert(key).nested[string(subkey)] = &nestedRecord{key: subkey, value: value}
+}
+
+// NestedDelete deletes a subkey from the nested tree of a key, the key keeps its value unless it is also put
+// A key deleted earlier in the batch has no nested tree left, so the record has no effect
+func (b *BatchBuilder) NestedDelete(key []byte, subkey []byte) {
+	e := b.entry(key)
+	if e.op == OpDelete {
+		return
+	}
+	e.nested[string(subkey)] = &nestedRecord{key: subkey, deleted: true}
+}
+
+// Build returns the balanced dict tree of the surviving records, nil for an empty batch
+// An upserted key without a value keeps the value it has in the tree the batch is applied to
+func (b *BatchBuilder) Build() *DictNode {
+	entries := make([]*DictNode, 0, len(b.entries))
+	for _, e := range b.entries {
+		updates := make([]*DictNode, 0)
+		deletes := make([]*DictNode, 0)
+		for _, r := range e.nested {
+			if r.deleted {
+				deletes = append(deletes, &DictNode{Key: r.key})
+			} else {
+				updates = append(updates, &DictNode{Key: r.key, Value: r.value})
+			}
+		}
+		entries = append(entries, &DictNode{
+			Key:    e.key,
+			Value:  e.value,
+			Update: balanceDict(updates),
+			Delete: balanceDict(deletes),
+			Op:     e.op,
+		})
+	}
+	return balanceDict(entries)
+}
+
+// balanceDict sorts dict entries by key, links them into a balanced dict tree and annotates their heights
+func balanceDict(entries []*DictNode) *DictNode {
+	sort.Slice(entries, func(i, j int) bool {
+		return bytes.Compare(entries[i].Key, entries[j].Key) == -1
+	})
+	return linkDict(entries)
+}
+
+func linkDict(entries []*DictNode) *DictNode {
+	if len(entries) == 0 {
+		return nil
+	}
+	mid := len(entries) / 2
+	root := entries[mid]
+	root.Left = linkDict(entries[:mid])
+	root.Right = linkDict(entries[mid+1:])
+	root.Height = balancedHeight(dictHeight(root.Left), dictHeight(root.Right))
+	return root
+}
+
+// dictHeight returns the height of a dict tree, 0 for an empty one
+func dictHeight(d *DictNode) int {
+	if d == nil {
+		return 0
+	}
+	return d.Height
+}
+
+// changeKind is the net effect of one or more batches on a key
+type changeKind int
+
+const (
+	upsertChange changeKind = iota
+	deleteChange
+	replaceChange
+	// nestedDeleteChange keeps the key and its value and only deletes keys from its nested tree
+	nestedDeleteChange
+)
+
+// change is the net effect of one or more batches on a key and on the keys of its nested tree
+type change struct {
+	key    []byte
+	value  []byte
+	kind   changeKind
+	nested map[string]*change
+}
+
+// ComposeBatches returns a batch that Apply applies in one pass with the same result as applying d1 and then d2
+// A key put in d2 after being deleted in d1 is replaced along with its nested tree, and the nested updates and deletes
+// of a key in both batches are composed the same way at every nesting level
+func ComposeBatches(d1 *DictNode, d2 *DictNode) *DictNode {
+	return emitBatch(composeChanges(batchChanges(d1, nil), batchChanges(d2, nil)))
+}
+
+// batchChanges adds the entries of a batch to a set of changes
+func batchChanges(d *DictNode, changes map[string]*change) map[string]*change {
+	if changes == nil {
+		changes = make(map[string]*change)
+	}
+	if d == nil {
+		return changes
+	}
+	c := &change{key: d.Key, value: d.Value, kind: upsertChange, nested: nestedChanges(d.Update, d.Delete)}
+	switch d.Op {
+	case OpDelete:
+		c = &change{key: d.Key, kind: deleteChange}
+	case OpReplace:
+		c.kind = replaceChange
+		c.nested = nestedChanges(d.Update, nil)
+	}
+	changes[string(d.Key)] = c
+	batchChanges(d.Left, changes)
+	return batchChanges(d.Right, changes)
+}
+
+// nestedChanges returns the changes nested updates and deletes make to a nested tree
+// A key in both is deleted and then upserted, which replaces it
+func nestedChanges(DU *DictNode, DD *DictNode) map[string]*change {
+	changes := make(map[string]*change)
+	for _, d := range DD.entries() {
+		if d.Delete != nil {
+			changes[string(d.Key)] = &change{key: d.Key, kind: nestedDeleteChange, nested: nestedChanges(nil, d.Delete)}
+		} else {
+			changes[string(d.Key)] = &change{key: d.Key, kind: deleteChange}
+		}
+	}
+	for _, u := range DU.entries() {
+		upsert := &change{key: u.Key, value: u.Value, kind: upsertChange, nested: nestedChanges(u.Update, u.Delete)}
+		if deleted, ok := changes[string(u.Key)]; ok && deleted.kind == deleteChange {
+			upsert.kind = replaceChange
+			upsert.nested = nestedChanges(u.Update, nil)
+		}
+		changes[string(u.Key)] = composeChange(changes[string(u.Key)], upsert)
+	}
+	return changes
+}
+
+// composeChanges returns the net effect of the changes c1 followed by the changes c2
+func composeChanges(c1 map[string]*change, c2 map[string]*change) map[string]*change {
+	changes := make(map[string]*change)
+	for k, c := range c1 {
+		changes[k] = c
+	}
+	for k, c := range c2 {
+		if composed := composeChange(changes[k], c); composed != nil {
+			changes[k] = composed
+		} else {
+			delete(changes, k)
+		}
+	}
+	return changes
+}
+
+// composeChange returns the net effect of c1 followed by c2 on a key, nil when it has none
+func composeChange(c1 *change, c2 *change) *change {
+	if c1 == nil {
+		return c2
+	}
+	switch c2.kind {
+	case deleteChange, replaceChange:
+		return c2
+	case upsertChange:
+		switch c1.kind {
+		case deleteChange:
+			return &change{key: c2.key, value: c2.value, kind: replaceChange, nested: c2.nested}
+		case nestedDeleteChange:
+			return &change{key: c2.key, value: c2.value, kind: upsertChange, nested: composeChanges(c1.nested, c2.nested)}
+		}
+		value := c2.value
+		if value == nil {
+			value = c1.value
+		}
+		return &change{key: c2.key, value: value, kind: c1.kind, nested: composeChanges(c1.nested, c2.nested)}
+	}
+	// A nested delete has no effect on a deleted key and is folded into the nested changes of any other
+	if c1.kind == deleteChange {
+		return c1
+	}
+	nested := composeChanges(c1.nested, c2.nested)
+	if c1.kind == nestedDeleteChange && len(nested) == 0 {
+		return nil
+	}
+	return &change{key: c1.key, value: c1.value, kind: c1.kind, nested: nested}
+}
+
+// emitBatch builds the batch making a set of changes to a tree
+func emitBatch(changes map[string]*change) *DictNode {
+	entries := make([]*DictNode, 0, len(changes))
+	for _, c := range changes {
+		entry := &DictNode{Key: c.key, Value: c.value}
+		switch c.kind {
+		case deleteChange:
+			entry.Op = OpDelete
+		case replaceChange:
+			entry.Op = OpReplace
+			entry.Update, _ = emitNested(c.nested)
+		default:
+			entry.Update, entry.Delete = emitNested(c.nested)
+		}
+		entries = append(entries, entry)
+	}
+	return balanceDict(entries)
+}
+
+// emitNested builds the nested updates and deletes making a set of changes to a nested tree
+// A replaced key is both deleted and upserted, and converting the updates of a key new to the tree ignores their deletes
+func emitNested(changes map[string]*change) (*DictNode, *DictNode) {
+	updates := make([]*DictNode, 0)
+	deletes := make([]*DictNode, 0)
+	for _, c := range changes {
+		switch c.kind {
+		case deleteChange:
+			deletes = append(deletes, &DictNode{Key: c.key})
+		case nestedDeleteChange:
+			_, DD := emitNested(c.nested)
+			deletes = append(deletes, &DictNode{Key: c.key, Delete: DD})
+		case replaceChange:
+			deletes = append(deletes, &DictNode{Key: c.key})
+			DU, _ := emitNested(c.nested)
+			updates = append(updates, &DictNode{Key: c.key, Value: c.value, Update: DU})
+		default:
+			DU, DD := emitNested(c.nested)
+			updates = append(updates, &DictNode{Key: c.key, Value: c.value, Update: DU, Delete: DD})
+		}
+	}
+	return balanceDict(updates), balanceDict(deletes)
+}
@@ -0,0 +1,223 @@
+package cairo_avl
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+)
+
+// checkDict fails unless a dict tree is ordered, balanced and annotated with its heights, and returns its height
+func checkDict(t *testing.T, d *DictNode) int {
+	if d == nil {
+		return 0
+	}
+	hL := checkDict(t, d.Left)
+	hR := checkDict(t, d.Right)
+	if hL > hR+1 || hR > hL+1 || d.Height != balancedHeight(hL, hR) {
+		t.Fatalf("dict entry %v has height %v with children of heights %v and %v", d.Key, d.Height, hL, hR)
+	}
+	if d.Left != nil && bytes.Compare(d.Left.Key, d.Key) != -1 || d.Right != nil && bytes.Compare(d.Right.Key, d.Key) != 1 {
+		t.Fatalf("dict entry %v is out of order", d.Key)
+	}
+	checkDict(t, d.Update)
+	checkDict(t, d.Delete)
+	return d.Height
+}
+
+// findDict returns the entry of a key in a dict tree
+func findDict(d *DictNode, k []byte) *DictNode {
+	for d != nil && !bytes.Equal(d.Key, k) {
+		if bytes.Compare(k, d.Key) == -1 {
+			d = d.Left
+		} else {
+			d = d.Right
+		}
+	}
+	return d
+}
+
+func TestBatchBuilderKeepsTheLastRecord(t *testing.T) {
+	b := NewBatchBuilder()
+	for _, k := range []byte{9, 3, 7, 1, 5, 8, 2, 6, 4} {
+		b.Put([]byte{k}, []byte{k, 0})
+	}
+	b.Put([]byte{3}, []byte{3, 1})
+	b.Delete([]byte{4})
+	b.Delete([]byte{5})
+	b.Put([]byte{5}, []byte{5, 1})
+	b.NestedPut([]byte{6}, []byte{6, 1}, []byte{1})
+	b.NestedPut([]byte{6}, []byte{6, 1}, []byte{2})
+	b.NestedPut([]byte{6}, []byte{6, 2}, []byte{1})
+	b.NestedDelete([]byte{6}, []byte{6, 2})
+	b.NestedDelete([]byte{6}, []byte{6, 3})
+	b.NestedPut([]byte{7}, []byte{7, 1}, []byte{1})
+	b.Delete([]byte{7})
+	b.NestedDelete([]byte{10}, []byte{10, 1})
+
+	D := b.Build()
+	checkDict(t, D)
+	if keys := D.keys(); len(keys) != 10 {
+		t.Fatalf("built %v entries, expected 10", len(keys))
+	}
+	if d := findDict(D, []byte{3}); !bytes.Equal(d.Value, []byte{3, 1}) {
+		t.Fatalf("key 3 has value %v, expected the last put", d.Value)
+	}
+	if d := findDict(D, []byte{4}); d.Op != OpDelete {
+		t.Fatalf("key 4 is not deleted")
+	}
+	if d := findDict(D, []byte{5}); d.Op != OpReplace || !bytes.Equal(d.Value, []byte{5, 1}) {
+		t.Fatalf("key 5 is not replaced after its delete")
+	}
+	d := findDict(D, []byte{6})
+	if len(d.Update.keys()) != 1 || !bytes.Equal(findDict(d.Update, []byte{6, 1}).Value, []byte{2}) {
+		t.Fatalf("key 6 has nested updates %v, expected only the last put of 6 1", d.Update.keys())
+	}
+	if len(d.Delete.keys()) != 2 {
+		t.Fatalf("key 6 has nested deletes %v, expected 6 2 and 6 3", d.Delete.keys())
+	}
+	if d := findDict(D, []byte{7}); d.Op != OpDelete || d.Update != nil {
+		t.Fatalf("key 7 keeps its nested records after its delete")
+	}
+	if d := findDict(D, []byte{10}); d.Op != OpUpsert || d.Value != nil {
+		t.Fatalf("key 10 only has a nested record but is not an upsert without value")
+	}
+}
+
+func TestBatchBuilderDeleteThenPut(t *testing.T) {
+	pool := *(EmbedByteArray([]byte{100, 101, 102, 103, 104, 105, 106, 107, 108, 109, 110, 111}))
+	b1 := *(EmbedByteArray([]byte{1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15, 16}))
+	t1 := BuildTreeFromInorder(&b1)
+	nestPool(t1, pool, new(int))
+
+	deletes := NewBatchBuilder()
+	deletes.Delete(b1[0])
+	puts := NewBatchBuilder()
+	puts.Put(b1[0], []byte{1})
+	expected := Apply(Apply(t1, deletes.Build(), nil), puts.Build(), nil)
+
+	b := NewBatchBuilder()
+	b.Delete(b1[0])
+	b.Put(b1[0], []byte{1})
+	T := Apply(t1, b.Build(), nil)
+
+	if v, _ := Get(T, b1[0], nil); !bytes.Equal(v, []byte{1}) {
+		t.Fatalf("key %v has value %v, expected the put value", b1[0], v)
+	}
+	if keys, expectedKeys := nestedKeys(T, b1[0]), nestedKeys(expected, b1[0]); len(keys) != 0 || len(expectedKeys) != 0 {
+		t.Fatalf("key %v holds %v after a delete and a put, applying them one after another gives %v", b1[0], keys, expectedKeys)
+	}
+}
+
+func TestBatchBuilderDeleteThenNestedDelete(t *testing.T) {
+	pool := *(EmbedByteArray([]byte{100, 101, 102, 103, 104, 105, 106, 107, 108, 109, 110, 111}))
+	b1 := *(EmbedByteArray([]byte{1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15, 16}))
+	t1 := BuildTreeFromInorder(&b1)
+	nestPool(t1, pool, new(int))
+
+	b := NewBatchBuilder()
+	b.Delete(b1[0])
+	b.NestedDelete(b1[0], pool[0])
+	T := Apply(t1, b.Build(), nil)
+
+	if v, ok := Get(T, b1[0], nil); ok {
+		t.Fatalf("key %v has value %v after a delete and a nested delete, expected it deleted", b1[0], v)
+	}
+	if len(nestedKeys(T, b1[0])) != 0 {
+		t.Fatalf("key %v still holds a nested tree", b1[0])
+	}
+}
+
+func TestApplyBatch(t *testing.T) {
+	pool := *(EmbedByteArray([]byte{100, 101, 102, 103, 104, 105, 106, 107, 108, 109, 110, 111, 112, 113, 114, 115, 116, 117, 118, 119, 120, 121, 122, 123}))
+	b1 := *(EmbedByteArray([]byte{1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15, 16}))
+	t1 := BuildTreeFromInorder(&b1)
+	nestPool(t1, pool, new(int))
+	// The first key holds the first and the fourth keys of the pool
+	nested := nestedKeys(t1, b1[0])
+
+	b := NewBatchBuilder()
+	b.NestedDelete(b1[0], nested[0])
+	b.NestedPut(b1[0], []byte{7}, []byte{7})
+	b.Put(b1[1], []byte{1})
+	b.Delete(b1[2])
+	b.Put([]byte{0}, []byte{0})
+
+	T := Apply(t1, b.Build(), nil)
+	if v, _ := Get(T, b1[0], nil); !bytes.Equal(v, b1[0]) {
+		t.Fatalf("key %v has value %v, expected the value it had", b1[0], v)
+	}
+	if v, _ := Get(T, b1[1], nil); !bytes.Equal(v, []byte{1}) {
+		t.Fatalf("key %v has value %v, expected the put value", b1[1], v)
+	}
+	if _, found := Get(T, b1[2], nil); found {
+		t.Fatalf("key %v was not deleted", b1[2])
+	}
+	if _, found := Get(T, []byte{0}, nil); !found {
+		t.Fatalf("key [0] was not inserted")
+	}
+	keys := nestedKeys(T, b1[0])
+	if len(keys) != len(nested) || !bytes.Equal(keys[0], []byte{7}) || !bytes.Equal(keys[1], nested[1]) {
+		t.Fatalf("key %v holds %v, expected %v without its first key and with [7]", b1[0], keys, nested)
+	}
+}
+
+// batchFromRecords builds a batch from records of three bytes: the key, the nested key and the record kind and value
+// The kinds are put, nested put, nested delete and delete, only the first ones are used when there are fewer
+func batchFromRecords(records []byte, kinds byte) *DictNode {
+	b := NewBatchBuilder()
+	for i := 0; i+2 < len(records); i += 3 {
+		key, subkey, value := []byte{records[i] % 16}, []byte{records[i+1] % 8}, []byte{records[i+2]}
+		switch records[i+2] % kinds {
+		case 0:
+			b.Put(key, value)
+		case 1:
+			b.NestedPut(key, subkey, value)
+		case 2:
+			b.NestedDelete(key, subkey)
+		default:
+			b.Delete(key)
+		}
+	}
+	return b.Build()
+}
+
+// recordsTree builds a tree holding the even keys of the records, each with some of their nested keys
+func recordsTree() *Node {
+	keys := make([][]byte, 0)
+	for k := byte(0); k < 16; k += 2 {
+		keys = append(keys, []byte{k})
+	}
+	pool := make([][]byte, 0)
+	for k := byte(0); k < 8; k++ {
+		pool = append(pool, []byte{k})
+	}
+	T := BuildTreeFromInorder(&keys)
+	nestPool(T, pool, new(int))
+	return T
+}
+
+// render prints the keys and values of a tree, nested trees included, in order
+func render(T *Node) string {
+	if T == nil {
+		return ""
+	}
+	return render(T.Left) + fmt.Sprintf("%v=%v{%s}", T.Key, T.Value, render(T.Nested)) + render(T.Right)
+}
+
+func FuzzComposeBatches(f *testing.F) {
+	f.Add([]byte{2, 1, 0, 3, 1, 2, 4, 2, 3, 5, 0, 1}, []byte{2, 1, 1, 3, 1, 3, 5, 2, 2, 4, 2, 4})
+
+	f.Fuzz(func(t *testing.T, records1 []byte, records2 []byte) {
+		t1 := recordsTree()
+
+		d1 := batchFromRecords(records1, 4)
+		d2 := batchFromRecords(records2, 4)
+		D := ComposeBatches(d1, d2)
+		checkDict(t, D)
+
+		expected := render(Apply(Apply(t1, d1, nil), d2, nil))
+		if actual := render(Apply(t1, D, nil)); actual != expected {
+			t.Fatalf("the composed batch gives %v, applying the batches one after another gives %v", actual, expected)
+		}
+	})
+}
@@ -14,144 +14,180 @@ func balancedHeight(hL int, hR int) int {
 }
 
 // rotateRight rotates a node to the right to maintain the AVL balance criteria
-func rotateLeft(k []byte, v []byte, TL *Node, TR *Node, TN *Node, numOfExposedNodes *int, numOfHeightTakenNodes *int) (int, *Node) {
-	kR, vR, TRL, TRR, TRN := exposeNode(TR, numOfExposedNodes, numOfHeightTakenNodes)
-	hL := HeightOf(TL, numOfHeightTakenNodes)
-	hRL := HeightOf(TRL, numOfHeightTakenNodes)
-	hRR := HeightOf(TRR, numOfHeightTakenNodes)
+func rotateLeft(k []byte, v []byte, TL *Node, TR *Node, TN *Node, tracker CostTracker) (int, *Node) {
+	tracker.Rotation()
+	kR, vR, TRL, TRR, TRN := exposeNode(TR, tracker)
+	hL := HeightOf(TL, tracker)
+	hRL := HeightOf(TRL, tracker)
+	hRR := HeightOf(TRR, tracker)
 	hP := balancedHeight(hL, hRL)
-	TP := NewNode(k, v, hP, TL, TRL, TN)
+	TP := newNode(k, v, hP, TL, TRL, TN, tracker)
 	h := balancedHeight(hP, hRR)
-	return h, NewNode(kR, vR, h, TP, TRR, TRN)
+	return h, newNode(kR, vR, h, TP, TRR, TRN, tracker)
 }
 
 // rotateLeft rotates a node to the left to maintain the AVL balance criteria
-func rotateRight(k []byte, v []byte, TL *Node, TR *Node, TN *Node, numOfExposedNodes *int, numOfHeightTakenNodes *int) (int, *Node) {
-	kL, vL, TLL, TLR, TLN := exposeNode(TL, numOfExposedNodes, numOfHeightTakenNodes)
-	hR := HeightOf(TR, numOfHeightTakenNodes)
-	hLL := HeightOf(TLL, numOfHeightTakenNodes)
-	hLR := HeightOf(TLR, numOfHeightTakenNodes)
+func rotateRight(k []byte, v []byte, TL *Node, TR *Node, TN *Node, tracker CostTracker) (int, *Node) {
+	tracker.Rotation()
+	kL, vL, TLL, TLR, TLN := exposeNode(TL, tracker)
+	hR := HeightOf(TR, tracker)
+	hLL := HeightOf(TLL, tracker)
+	hLR := HeightOf(TLR, tracker)
 	hP := balancedHeight(hR, hLR)
-	TP := NewNode(k, v, hP, TLR, TR, TN)
+	TP := newNode(k, v, hP, TLR, TR, TN, tracker)
 	h := balancedHeight(hP, hLL)
-	return h, NewNode(kL, vL, h, TLL, TP, TLN)
+	return h, newNode(kL, vL, h, TLL, TP, TLN, tracker)
 }
 
 // joinRight concatenates a left tree, k and a right tree
-func joinRight(k []byte, v []byte, TL *Node, TR *Node, TN *Node, numOfExposedNodes *int, numOfHeightTakenNodes *int) (int, *Node) {
-	kL, vL, TLL, TLR, TLN := exposeNode(TL, numOfExposedNodes, numOfHeightTakenNodes)
-	hLR := HeightOf(TLR, numOfHeightTakenNodes)
-	hR := HeightOf(TR, numOfHeightTakenNodes)
-	hLL := HeightOf(TLL, numOfHeightTakenNodes)
+func joinRight(k []byte, v []byte, TL *Node, TR *Node, TN *Node, tracker CostTracker) (int, *Node) {
+	kL, vL, TLL, TLR, TLN := exposeNode(TL, tracker)
+	hLR := HeightOf(TLR, tracker)
+	hR := HeightOf(TR, tracker)
+	hLL := HeightOf(TLL, tracker)
 	if hLR <= hR+1 {
 		hP := balancedHeight(hLR, hR)
 		if hP <= hLL+1 {
 			h := balancedHeight(hLL, balancedHeight(hLR, hR))
-			return h, NewNode(kL, vL, h, TLL, NewNode(k, v, hP, TLR, TR, TN), TLN)
+			return h, newNode(kL, vL, h, TLL, newNode(k, v, hP, TLR, TR, TN, tracker), TLN, tracker)
 		}
-		_, TP := rotateRight(k, v, TLR, TR, TN, numOfExposedNodes, numOfHeightTakenNodes)
-		return rotateLeft(kL, vL, TLL, TP, TLN, numOfExposedNodes, numOfHeightTakenNodes)
+		_, TP := rotateRight(k, v, TLR, TR, TN, tracker)
+		return rotateLeft(kL, vL, TLL, TP, TLN, tracker)
 	}
-	hP, TP := joinRight(k, v, TLR, TR, TN, numOfExposedNodes, numOfHeightTakenNodes)
+	hP, TP := joinRight(k, v, TLR, TR, TN, tracker)
 	if hP <= hLL+1 {
 		h := balancedHeight(hP, hLL)
-		return h, NewNode(kL, vL, h, TLL, TP, TLN)
+		return h, newNode(kL, vL, h, TLL, TP, TLN, tracker)
 	}
-	return rotateLeft(kL, vL, TLL, TP, TLN, numOfExposedNodes, numOfHeightTakenNodes)
+	return rotateLeft(kL, vL, TLL, TP, TLN, tracker)
 }
 
-func joinLeft(k []byte, v []byte, TL *Node, TR *Node, TN *Node, numOfExposedNodes *int, numOfHeightTakenNodes *int) (int, *Node) {
-	kR, vR, TRL, TRR, TRN := exposeNode(TR, numOfExposedNodes, numOfHeightTakenNodes)
-	hRL := HeightOf(TRL, numOfHeightTakenNodes)
-	hL := HeightOf(TL, numOfHeightTakenNodes)
-	hRR := HeightOf(TRR, numOfHeightTakenNodes)
+func joinLeft(k []byte, v []byte, TL *Node, TR *Node, TN *Node, tracker CostTracker) (int, *Node) {
+	kR, vR, TRL, TRR, TRN := exposeNode(TR, tracker)
+	hRL := HeightOf(TRL, tracker)
+	hL := HeightOf(TL, tracker)
+	hRR := HeightOf(TRR, tracker)
 	if hRL <= hL+1 {
 		hP := balancedHeight(hL, hRL)
 		if hP <= hRR+1 {
 			h := balancedHeight(hRR, balancedHeight(hL, hRL))
-			return h, NewNode(kR, vR, h, NewNode(k, v, hP, TL, TRL, TN), TRR, TRN)
+			return h, newNode(kR, vR, h, newNode(k, v, hP, TL, TRL, TN, tracker), TRR, TRN, tracker)
 		}
-		_, TP := rotateLeft(k, v, TL, TRL, TN, numOfExposedNodes, numOfHeightTakenNodes)
-		return rotateRight(kR, vR, TP, TRR, TRN, numOfExposedNodes, numOfHeightTakenNodes)
+		_, TP := rotateLeft(k, v, TL, TRL, TN, tracker)
+		return rotateRight(kR, vR, TP, TRR, TRN, tracker)
 	}
-	hP, TP := joinLeft(k, v, TL, TRL, TN, numOfExposedNodes, numOfHeightTakenNodes)
+	hP, TP := joinLeft(k, v, TL, TRL, TN, tracker)
 	if hP <= hRR+1 {
 		h := balancedHeight(hP, hRR)
-		return h, NewNode(kR, vR, h, TP, TRR, TRN)
+		return h, newNode(kR, vR, h, TP, TRR, TRN, tracker)
 	}
-	return rotateRight(kR, vR, TP, TRR, TRN, numOfExposedNodes, numOfHeightTakenNodes)
+	return rotateRight(kR, vR, TP, TRR, TRN, tracker)
 }
 
-func join(k []byte, v []byte, DU *DictNode, DD *DictNode, TL *Node, TR *Node, TN *Node, numOfExposedNodes *int, numOfHeightTakenNodes *int) *Node {
-	hL := HeightOf(TL, numOfHeightTakenNodes)
-	hR := HeightOf(TR, numOfHeightTakenNodes)
+// join concatenates a left tree, k and a right tree, the nested tree of k is TN with the keys of DD removed and the keys
+// of DU upserted, whichever way the trees are rebalanced
+func join(k []byte, v []byte, DU *DictNode, DD *DictNode, TL *Node, TR *Node, TN *Node, tracker CostTracker) *Node {
+	tracker.Join()
+	N := nested(TN, DU, DD, tracker)
+	hL := HeightOf(TL, tracker)
+	hR := HeightOf(TR, tracker)
 	if hL > hR+1 {
-		_, T := joinRight(k, v, TL, TR, TN, numOfExposedNodes, numOfHeightTakenNodes)
+		_, T := joinRight(k, v, TL, TR, N, tracker)
 		return T
 	}
 	if hR > hL+1 {
-		_, T := joinLeft(k, v, TL, TR, TN, numOfExposedNodes, numOfHeightTakenNodes)
+		_, T := joinLeft(k, v, TL, TR, N, tracker)
 		return T
 	}
-	N := Union(Difference(TN, DU, numOfExposedNodes, numOfHeightTakenNodes), DD, numOfExposedNodes, numOfHeightTakenNodes)
 	h := balancedHeight(hL, hR)
-	return NewNode(k, v, h, TL, TR, N)
+	return newNode(k, v, h, TL, TR, N, tracker)
 }
 
-func splitLast(T *Node, numOfExposedNodes *int, numOfHeightTakenNodes *int) (*Node, []byte, []byte, *Node) {
-	m, v, L, R, N := exposeNode(T, numOfExposedNodes, numOfHeightTakenNodes)
+// nested applies the nested deletes and then the nested updates of a dict key to its nested tree, so a nested key in
+// both is upserted, the entries of DU carry their own nested updates so the changes reach any nesting depth
+func nested(TN *Node, DU *DictNode, DD *DictNode, tracker CostTracker) *Node {
+	if DU == nil && DD == nil {
+		return TN
+	}
+	tracker = nest(tracker)
+	return union(difference(TN, DD, tracker, 0), DU, tracker, 0)
+}
+
+func splitLast(T *Node, tracker CostTracker) (*Node, []byte, []byte, *Node) {
+	m, v, L, R, N := exposeNode(T, tracker)
 	if R == nil {
 		return L, m, v, N
 	}
 
-	TP, kP, vP, NP := splitLast(R, numOfExposedNodes, numOfHeightTakenNodes)
-	return join(m, v, nil, nil, L, TP, N, numOfExposedNodes, numOfHeightTakenNodes), kP, vP, NP
+	TP, kP, vP, NP := splitLast(R, tracker)
+	return join(m, v, nil, nil, L, TP, N, tracker), kP, vP, NP
 }
 
-func join2(TL *Node, TR *Node, numOfExposedNodes *int, numOfHeightTakenNodes *int) *Node {
+func join2(TL *Node, TR *Node, tracker CostTracker) *Node {
 	if TL == nil {
 		return TR
 	}
-	TLP, k, v, N := splitLast(TL, numOfExposedNodes, numOfHeightTakenNodes)
-	return join(k, v, nil, nil, TLP, TR, N, numOfExposedNodes, numOfHeightTakenNodes)
+	TLP, k, v, N := splitLast(TL, tracker)
+	return join(k, v, nil, nil, TLP, TR, N, tracker)
 }
 
-func split(t *Node, k []byte, numOfExposedNodes *int, numOfHeightTakenNodes *int) (*Node, *Node, *Node) {
+// split separates a tree into the trees of the keys smaller and greater than k, along with the nested tree and
+// the value of k, and whether k was in the tree
+func split(t *Node, k []byte, tracker CostTracker) (*Node, *Node, *Node, []byte, bool) {
 	if t == nil {
-		return nil, nil, nil
+		return nil, nil, nil, nil, false
 	}
+	tracker.Split()
 
-	m, v, L, R, N := exposeNode(t, numOfExposedNodes, numOfHeightTakenNodes)
+	m, v, L, R, N := exposeNode(t, tracker)
 	if bytes.Compare(k, m) == 0 {
-		return L, R, N
+		return L, R, N, v, true
 	}
 
 	if bytes.Compare(k, m) == -1 {
-		LL, LR, LN := split(L, k, numOfExposedNodes, numOfHeightTakenNodes)
-		return LL, join(m, v, nil, nil, LR, R, N, numOfExposedNodes, numOfHeightTakenNodes), LN
+		LL, LR, LN, LV, found := split(L, k, tracker)
+		return LL, join(m, v, nil, nil, LR, R, N, tracker), LN, LV, found
 	}
 
-	RL, RR, RN := split(R, k, numOfExposedNodes, numOfHeightTakenNodes)
-	return join(m, v, nil, nil, L, RL, N, numOfExposedNodes, numOfHeightTakenNodes), RR, RN
+	RL, RR, RN, RV, found := split(R, k, tracker)
+	return join(m, v, nil, nil, L, RL, N, tracker), RR, RN, RV, found
 }
 
-func Union(T0 *Node, D *DictNode, numOfExposedNodes *int, numOfHeightTakenNodes *int) *Node {
+// Union upserts every key of D into T0, reporting the cost to the tracker, which may be nil
+// An entry of D without a value keeps the value of its key in T0
+func Union(T0 *Node, D *DictNode, tracker CostTracker) *Node {
+	return union(T0, D, orNop(tracker), 0)
+}
+
+func union(T0 *Node, D *DictNode, tracker CostTracker, cutoff int) *Node {
 	if T0 == nil {
-		return D.ConvertToNode()
+		return D.convertToNode(tracker)
 	}
 	if D == nil {
 		return T0
 	}
 
 	k, v, DL, DR, DU, DD := exposeDict(D)
-	TL, TR, TN := split(T0, k, numOfExposedNodes, numOfHeightTakenNodes)
-	L := Union(TL, DL, numOfExposedNodes, numOfHeightTakenNodes)
-	R := Union(TR, DR, numOfExposedNodes, numOfHeightTakenNodes)
-	joined := join(k, v, DU, DD, L, R, TN, numOfExposedNodes, numOfHeightTakenNodes)
+	TL, TR, TN, TV, _ := split(T0, k, tracker)
+	if v == nil {
+		v = TV
+	}
+	L, R := fork(D, cutoff, tracker, func(tracker CostTracker) *Node {
+		return union(TL, DL, tracker, cutoff)
+	}, func(tracker CostTracker) *Node {
+		return union(TR, DR, tracker, cutoff)
+	})
+	joined := join(k, v, DU, DD, L, R, TN, tracker)
 	return joined
 }
 
-func Difference(T0 *Node, D *DictNode, numOfExposedNodes *int, numOfHeightTakenNodes *int) *Node {
+// Difference removes every key of D from T0, reporting the cost to the tracker, which may be nil
+// An entry of D with a nested Delete dict only removes those keys from the nested tree of its key and keeps the key
+func Difference(T0 *Node, D *DictNode, tracker CostTracker) *Node {
+	return difference(T0, D, orNop(tracker), 0)
+}
+
+func difference(T0 *Node, D *DictNode, tracker CostTracker, cutoff int) *Node {
 	if T0 == nil {
 		return nil
 	}
@@ -159,9 +195,118 @@ func Difference(T0 *Node, D *DictNode, numOfExposedNodes *int, numOfHeightTakenN
 		return T0
 	}
 
+	k, _, DL, DR, _, DD := exposeDict(D)
+	TL, TR, TN, v, found := split(T0, k, tracker)
+	L, R := fork(D, cutoff, tracker, func(tracker CostTracker) *Node {
+		return difference(TL, DL, tracker, cutoff)
+	}, func(tracker CostTracker) *Node {
+		return difference(TR, DR, tracker, cutoff)
+	})
+	if found && DD != nil {
+		return join(k, v, nil, DD, L, R, TN, tracker)
+	}
+	return join2(L, R, tracker)
+}
+
+// Intersection keeps the keys of T0 that are also in D, with their values and nested trees from T0, reporting the cost
+// to the tracker, which may be nil
+func Intersection(T0 *Node, D *DictNode, tracker CostTracker) *Node {
+	tracker = orNop(tracker)
+	if T0 == nil || D == nil {
+		return nil
+	}
+
 	k, _, DL, DR, _, _ := exposeDict(D)
-	TL, TR, _ := split(T0, k, numOfExposedNodes, numOfHeightTakenNodes)
-	L := Difference(TL, DL, numOfExposedNodes, numOfHeightTakenNodes)
-	R := Difference(TR, DR, numOfExposedNodes, numOfHeightTakenNodes)
-	return join2(L, R, numOfExposedNodes, numOfHeightTakenNodes)
+	TL, TR, TN, v, found := split(T0, k, tracker)
+	L := Intersection(TL, DL, tracker)
+	R := Intersection(TR, DR, tracker)
+	if !found {
+		return join2(L, R, tracker)
+	}
+	return join(k, v, nil, nil, L, R, TN, tracker)
+}
+
+// SymmetricDifference keeps the keys that are in exactly one of T0 and D, the keys of D come with their value and
+// nested updates, reporting the cost to the tracker, which may be nil
+func SymmetricDifference(T0 *Node, D *DictNode, tracker CostTracker) *Node {
+	tracker = orNop(tracker)
+	if T0 == nil {
+		return D.convertToNode(tracker)
+	}
+	if D == nil {
+		return T0
+	}
+
+	k, v, DL, DR, DU, DD := exposeDict(D)
+	TL, TR, _, _, found := split(T0, k, tracker)
+	L := SymmetricDifference(TL, DL, tracker)
+	R := SymmetricDifference(TR, DR, tracker)
+	if found {
+		return join2(L, R, tracker)
+	}
+	return join(k, v, DU, DD, L, R, nil, tracker)
+}
+
+// Get returns the value of a key and whether it is in the tree, exposing the nodes on its search path to the tracker,
+// which may be nil
+func Get(T *Node, k []byte, tracker CostTracker) ([]byte, bool) {
+	tracker = orNop(tracker)
+	for T != nil {
+		m, v, L, R, _ := exposeNode(T, tracker)
+		switch bytes.Compare(k, m) {
+		case 0:
+			return v, true
+		case -1:
+			T = L
+		default:
+			T = R
+		}
+	}
+	return nil, false
+}
+
+// Put inserts a key into a tree, or replaces its value and keeps its nested tree if it is already there, reporting
+// the cost to the tracker, which may be nil
+func Put(T *Node, k []byte, v []byte, tracker CostTracker) *Node {
+	tracker = orNop(tracker)
+	TL, TR, TN, _, _ := split(T, k, tracker)
+	return join(k, v, nil, nil, TL, TR, TN, tracker)
+}
+
+// Delete removes a key and its nested tree from a tree, reporting the cost to the tracker, which may be nil
+func Delete(T *Node, k []byte, tracker CostTracker) *Node {
+	tracker = orNop(tracker)
+	TL, TR, _, _, _ := split(T, k, tracker)
+	return join2(TL, TR, tracker)
+}
+
+// Apply upserts, deletes or replaces every key of D in T0 according to its Op in a single pass, reporting the cost to the
+// tracker, which may be nil
+// As in Union, an upsert entry without a value keeps the value of its key in T0
+func Apply(T0 *Node, D *DictNode, tracker CostTracker) *Node {
+	return apply(T0, D, orNop(tracker))
+}
+
+func apply(T0 *Node, D *DictNode, tracker CostTracker) *Node {
+	if D == nil {
+		return T0
+	}
+	if T0 == nil && !D.hasDeletes() {
+		return D.convertToNode(tracker)
+	}
+
+	k, v, DL, DR, DU, DD := exposeDict(D)
+	TL, TR, TN, TV, _ := split(T0, k, tracker)
+	L := apply(TL, DL, tracker)
+	R := apply(TR, DR, tracker)
+	switch D.Op {
+	case OpDelete:
+		return join2(L, R, tracker)
+	case OpReplace:
+		return join(k, v, DU, nil, L, R, nil, tracker)
+	}
+	if v == nil {
+		v = TV
+	}
+	return join(k, v, DU, DD, L, R, TN, tracker)
 }
@@ -1,6 +1,7 @@
 package cairo_avl
 
 import (
+	"bytes"
 	"fmt"
 	"testing"
 )
@@ -11,7 +12,7 @@ func FuzzUnion(f *testing.F) {
 	f.Add([]byte{1, 2, 3, 4, 5, 6}, []byte{14, 15, 16, 17, 18, 19})
 
 	f.Fuzz(func(t *testing.T, input1 []byte, input2 []byte) {
-		numOfExposedNodes = 0
+		session := NewSession()
 
 		b1 := *(EmbedByteArray(input1))
 		b2 := *(EmbedByteArray(input2))
@@ -19,15 +20,19 @@ func FuzzUnion(f *testing.F) {
 		t1 := BuildTreeFromInorder(&b1)
 		D := BuildDictTreeFromInorder(&b2)
 
-		tU, _ := Union(t1, D)
+		tU := Union(t1, D, session)
 
 		numOfNodes := len(b1) + len(b2)
 
-		count := 0
-		CountNumberOfNewHashes(tU, &count)
-		fmt.Printf("Hash count for tree with size: %v is %v \n", numOfNodes, count+numOfExposedNodes)
+		count := session.CountNumberOfNewHashes(tU)
+		fmt.Printf("Hash count for tree with size: %v is %v \n", numOfNodes, count+session.Stats().ExposedNodes)
 		fmt.Println()
 
+		// Every node of tU that needs a new hash was created by the union
+		if count > session.Stats().CreatedNodes {
+			t.Fatalf("tU has %v new nodes, the union created %v", count, session.Stats().CreatedNodes)
+		}
+
 		// Check that all nodes in tU are either in t1 or t2
 		for _, key := range *(GetInorderTraversal(tU)) {
 			if !IsInTree(t1, &key) {
@@ -104,3 +109,497 @@ func FuzzUnion(f *testing.F) {
 //		}
 //	})
 //}
+
+func FuzzIntersection(f *testing.F) {
+	f.Add([]byte{1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15, 16}, []byte{5, 6, 7, 8, 20, 21, 22, 23, 13, 14, 15, 16})
+
+	f.Fuzz(func(t *testing.T, input1 []byte, input2 []byte) {
+		b1 := *(EmbedByteArray(input1))
+		b2 := *(EmbedByteArray(input2))
+
+		// The reference result is the set of keys present in both inputs
+		whitelist := make(map[string]bool)
+		for _, key := range b2 {
+			whitelist[string(key)] = true
+		}
+		expected := make(map[string]bool)
+		for _, key := range b1 {
+			if whitelist[string(key)] {
+				expected[string(key)] = true
+			}
+		}
+
+		t1 := BuildTreeFromInorder(&b1)
+		D := BuildDictTreeFromInorder(&b2)
+
+		tI := Intersection(t1, D, NewSession())
+
+		keys := *(GetInorderTraversal(tI))
+		if len(keys) != len(expected) {
+			t.Fatalf("tI has %v keys, expected %v", len(keys), len(expected))
+		}
+		for _, key := range keys {
+			if !expected[string(key)] {
+				t.Fatalf("Key: %v in tI not in both t1 and D", key)
+			}
+		}
+
+		// Check that tI is balanced
+		if !IsBalanced(tI) {
+			t.Fatalf("tI with root: %v is height unbalanced", tI)
+		}
+
+		// Check that tI is a valid BST
+		if !IsValidBST(tI) {
+			t.Fatalf("tI with root: %v is not a valid BST", tI)
+		}
+	})
+}
+
+func FuzzSymmetricDifference(f *testing.F) {
+	f.Add([]byte{1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15, 16}, []byte{5, 6, 7, 8, 20, 21, 22, 23, 13, 14, 15, 16})
+
+	f.Fuzz(func(t *testing.T, input1 []byte, input2 []byte) {
+		b1 := *(EmbedByteArray(input1))
+		b2 := *(EmbedByteArray(input2))
+
+		// The reference result is the set of keys present in exactly one of the inputs
+		expected := make(map[string]bool)
+		for _, key := range append(append([][]byte{}, b1...), b2...) {
+			expected[string(key)] = !expected[string(key)]
+		}
+		size := 0
+		for _, in := range expected {
+			if in {
+				size++
+			}
+		}
+
+		t1 := BuildTreeFromInorder(&b1)
+		D := BuildDictTreeFromInorder(&b2)
+
+		session := NewSession()
+		tS := SymmetricDifference(t1, D, session)
+
+		keys := *(GetInorderTraversal(tS))
+		if len(keys) != size {
+			t.Fatalf("tS has %v keys, expected %v", len(keys), size)
+		}
+		for _, key := range keys {
+			if !expected[string(key)] {
+				t.Fatalf("Key: %v in tS is in both t1 and D", key)
+			}
+		}
+
+		// Every node of tS that needs a new hash was created by the operation
+		if count := session.CountNumberOfNewHashes(tS); count > session.Stats().CreatedNodes {
+			t.Fatalf("tS has %v new nodes, the operation created %v", count, session.Stats().CreatedNodes)
+		}
+
+		// Check that tS is balanced
+		if !IsBalanced(tS) {
+			t.Fatalf("tS with root: %v is height unbalanced", tS)
+		}
+
+		// Check that tS is a valid BST
+		if !IsValidBST(tS) {
+			t.Fatalf("tS with root: %v is not a valid BST", tS)
+		}
+	})
+}
+
+func TestGetPutDelete(t *testing.T) {
+	reference := make(map[string][]byte)
+	var T *Node
+	for i := 0; i < 500; i++ {
+		k := []byte{byte(i * 37 % 101)}
+		session := NewSession()
+		switch i % 3 {
+		case 0, 1:
+			T = Put(T, k, []byte{byte(i)}, session)
+			reference[string(k)] = []byte{byte(i)}
+		case 2:
+			T = Delete(T, k, session)
+			delete(reference, string(k))
+		}
+		if session.Stats().Splits == 0 && i > 0 {
+			t.Fatalf("update %v was not reported to the session", i)
+		}
+
+		for j := 0; j < 101; j++ {
+			v, ok := Get(T, []byte{byte(j)}, nil)
+			expected, in := reference[string([]byte{byte(j)})]
+			if ok != in || !bytes.Equal(v, expected) {
+				t.Fatalf("Key: %v has value %v, %v in the tree, expected %v, %v", j, v, ok, expected, in)
+			}
+		}
+		if !IsBalanced(T) || !IsValidBST(T) {
+			t.Fatalf("tree is not a balanced BST after %v updates", i+1)
+		}
+	}
+
+	// A lookup exposes the nodes on the search path and nothing else
+	session := NewSession()
+	Get(T, T.Left.Left.Key, session)
+	if session.Stats().ExposedNodes != 3 || session.Stats().CreatedNodes != 0 {
+		t.Fatalf("a lookup at depth 3 recorded %+v", session.Stats())
+	}
+}
+
+func FuzzPutMatchesUnion(f *testing.F) {
+	f.Add([]byte{1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15, 16}, []byte{5, 6, 7, 8, 20, 21, 22, 23, 13, 14, 15, 16})
+
+	f.Fuzz(func(t *testing.T, input1 []byte, input2 []byte) {
+		b1 := *(EmbedByteArray(input1))
+		b2 := *(EmbedByteArray(input2))
+
+		t1 := BuildTreeFromInorder(&b1)
+		D := BuildDictTreeFromInorder(&b2)
+
+		T := t1
+		for _, k := range D.keys() {
+			T = Put(T, k, k, NewSession())
+		}
+		tU := Union(t1, D, nil)
+
+		keys := *(GetInorderTraversal(T))
+		expected := *(GetInorderTraversal(tU))
+		if len(keys) != len(expected) {
+			t.Fatalf("one key at a time gave %v keys, Union gave %v", len(keys), len(expected))
+		}
+		for i := range keys {
+			v, _ := Get(T, keys[i], nil)
+			w, _ := Get(tU, keys[i], nil)
+			if !bytes.Equal(keys[i], expected[i]) || !bytes.Equal(v, w) {
+				t.Fatalf("Key: %v differs between one key at a time and Union", keys[i])
+			}
+		}
+		if !IsBalanced(T) || !IsValidBST(T) {
+			t.Fatalf("T is not a balanced BST")
+		}
+	})
+}
+
+// markDeletes turns every other entry of a dict tree, in order, into a deletion and returns the deleted keys
+func markDeletes(D *DictNode, deleted map[string]bool, i *int) {
+	if D == nil {
+		return
+	}
+	markDeletes(D.Left, deleted, i)
+	if *i%2 == 1 {
+		D.Op = OpDelete
+		deleted[string(D.Key)] = true
+	}
+	*i++
+	markDeletes(D.Right, deleted, i)
+}
+
+func FuzzApply(f *testing.F) {
+	f.Add([]byte{1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15, 16}, []byte{5, 6, 7, 8, 20, 21, 22, 23, 13, 14, 15, 16, 9, 10, 11, 12})
+
+	f.Fuzz(func(t *testing.T, input1 []byte, input2 []byte) {
+		b1 := *(EmbedByteArray(input1))
+		b2 := *(EmbedByteArray(input2))
+
+		t1 := BuildTreeFromInorder(&b1)
+		D := BuildDictTreeFromInorder(&b2)
+		deleted := make(map[string]bool)
+		markDeletes(D, deleted, new(int))
+		oldRoot := RootHash(t1, SHA256Hasher, nil)
+
+		// The reference result applies the entries to a map
+		expected := make(map[string]bool)
+		for _, key := range b1 {
+			expected[string(key)] = true
+		}
+		for _, key := range D.keys() {
+			expected[string(key)] = !deleted[string(key)]
+		}
+		size := 0
+		for _, in := range expected {
+			if in {
+				size++
+			}
+		}
+
+		session := NewSession()
+		tA := Apply(t1, D, session)
+
+		keys := *(GetInorderTraversal(tA))
+		if len(keys) != size {
+			t.Fatalf("tA has %v keys, expected %v", len(keys), size)
+		}
+		for _, key := range keys {
+			if !expected[string(key)] {
+				t.Fatalf("Key: %v in tA was deleted or never inserted", key)
+			}
+		}
+
+		// Check that tA is balanced
+		if !IsBalanced(tA) {
+			t.Fatalf("tA with root: %v is height unbalanced", tA)
+		}
+
+		// Check that tA is a valid BST
+		if !IsValidBST(tA) {
+			t.Fatalf("tA with root: %v is not a valid BST", tA)
+		}
+
+		// The single pass can be replayed from its witness
+		w := BuildWitness(t1, tA, session, SHA256Hasher)
+		if _, err := VerifyApply(oldRoot, D, w, SHA256Hasher); err != nil {
+			t.Fatalf("replay failed: %v", err)
+		}
+	})
+}
+
+// nestedSubset returns the keys of the pool whose index plus offset is a multiple of mod
+func nestedSubset(pool [][]byte, offset int, mod int) [][]byte {
+	subset := make([][]byte, 0)
+	for j, key := range pool {
+		if (offset+j)%mod == 0 {
+			subset = append(subset, key)
+		}
+	}
+	return subset
+}
+
+// nestPool gives every key of a tree, in order, a third of the pool as its nested tree
+func nestPool(T *Node, pool [][]byte, i *int) {
+	if T == nil {
+		return
+	}
+	nestPool(T.Left, pool, i)
+	keys := nestedSubset(pool, *i, 3)
+	T.Nested = BuildTreeFromInorder(&keys)
+	*i++
+	nestPool(T.Right, pool, i)
+}
+
+// nestedModel records the nested keys of every key of a tree
+func nestedModel(T *Node, model map[string]map[string]bool) {
+	if T == nil {
+		return
+	}
+	keys := make(map[string]bool)
+	for _, key := range *(GetInorderTraversal(T.Nested)) {
+		keys[string(key)] = true
+	}
+	model[string(T.Key)] = keys
+	nestedModel(T.Left, model)
+	nestedModel(T.Right, model)
+}
+
+func FuzzNestedUpdates(f *testing.F) {
+	f.Add([]byte{1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15, 16, 17, 18, 19, 20, 21, 22, 23, 24},
+		[]byte{30, 31, 32, 33, 34, 35, 36, 37, 1, 2, 3, 4, 9, 10, 11, 12},
+		[]byte{100, 101, 102, 103, 104, 105, 106, 107, 108, 109, 110, 111, 112, 113, 114, 115, 116, 117, 118, 119})
+
+	f.Fuzz(func(t *testing.T, input1 []byte, input2 []byte, input3 []byte) {
+		b1 := *(EmbedByteArray(input1))
+		b2 := *(EmbedByteArray(input2))
+		pool := *(EmbedByteArray(input3))
+
+		t1 := BuildTreeFromInorder(&b1)
+		nestPool(t1, pool, new(int))
+
+		// Every entry of D upserts another third of the pool and deletes half of it
+		D := BuildDictTreeFromInorder(&b2)
+		i := 0
+		var update func(D *DictNode)
+		update = func(D *DictNode) {
+			if D == nil {
+				return
+			}
+			update(D.Left)
+			updates := nestedSubset(pool, i+2, 3)
+			deletes := nestedSubset(pool, i, 2)
+			D.Update = BuildDictTreeFromInorder(&updates)
+			D.Delete = BuildDictTreeFromInorder(&deletes)
+			i++
+			update(D.Right)
+		}
+		update(D)
+
+		// The reference result applies the nested deletes and then the nested updates to a map of maps
+		expected := make(map[string]map[string]bool)
+		nestedModel(t1, expected)
+		var apply func(D *DictNode)
+		apply = func(D *DictNode) {
+			if D == nil {
+				return
+			}
+			keys := expected[string(D.Key)]
+			if keys == nil {
+				keys = make(map[string]bool)
+				expected[string(D.Key)] = keys
+			}
+			for _, key := range D.Delete.keys() {
+				delete(keys, string(key))
+			}
+			for _, key := range D.Update.keys() {
+				keys[string(key)] = true
+			}
+			apply(D.Left)
+			apply(D.Right)
+		}
+		apply(D)
+
+		tU := Union(t1, D, nil)
+
+		actual := make(map[string]map[string]bool)
+		nestedModel(tU, actual)
+		if len(actual) != len(expected) {
+			t.Fatalf("tU has %v keys, expected %v", len(actual), len(expected))
+		}
+		for key, keys := range expected {
+			got, ok := actual[key]
+			if !ok {
+				t.Fatalf("Key: %v not in tU", []byte(key))
+			}
+			if len(got) != len(keys) {
+				t.Fatalf("Key: %v has %v nested keys, expected %v", []byte(key), len(got), len(keys))
+			}
+			for nestedKey := range keys {
+				if !got[nestedKey] {
+					t.Fatalf("Key: %v is missing nested key %v", []byte(key), []byte(nestedKey))
+				}
+			}
+		}
+
+		// Check that the nested trees are balanced BSTs
+		var check func(T *Node)
+		check = func(T *Node) {
+			if T == nil {
+				return
+			}
+			if !IsBalanced(T.Nested) || !IsValidBST(T.Nested) {
+				t.Fatalf("nested tree of key: %v is not a balanced BST", T.Key)
+			}
+			check(T.Left)
+			check(T.Right)
+		}
+		check(tU)
+	})
+}
+
+func FuzzNestedDifference(f *testing.F) {
+	f.Add([]byte{1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15, 16, 17, 18, 19, 20, 21, 22, 23, 24},
+		[]byte{30, 31, 32, 33, 5, 6, 7, 8, 1, 2, 3, 4, 9, 10, 11, 12, 17, 18, 19, 20},
+		[]byte{100, 101, 102, 103, 104, 105, 106, 107, 108, 109, 110, 111, 112, 113, 114, 115, 116, 117, 118, 119})
+
+	f.Fuzz(func(t *testing.T, input1 []byte, input2 []byte, input3 []byte) {
+		b1 := *(EmbedByteArray(input1))
+		b2 := *(EmbedByteArray(input2))
+		pool := *(EmbedByteArray(input3))
+
+		t1 := BuildTreeFromInorder(&b1)
+		nestPool(t1, pool, new(int))
+		RootHash(t1, SHA256Hasher, nil)
+
+		// Every other entry of D only deletes half of the pool from the nested tree of its key
+		D := BuildDictTreeFromInorder(&b2)
+		i := 0
+		var mark func(D *DictNode)
+		mark = func(D *DictNode) {
+			if D == nil {
+				return
+			}
+			mark(D.Left)
+			if i%2 == 1 {
+				deletes := nestedSubset(pool, i, 2)
+				D.Delete = BuildDictTreeFromInorder(&deletes)
+			}
+			i++
+			mark(D.Right)
+		}
+		mark(D)
+
+		// The reference result applies the entries to a map of maps
+		expected := make(map[string]map[string]bool)
+		nestedModel(t1, expected)
+		var apply func(D *DictNode)
+		apply = func(D *DictNode) {
+			if D == nil {
+				return
+			}
+			keys, ok := expected[string(D.Key)]
+			if ok && D.Delete != nil {
+				for _, key := range D.Delete.keys() {
+					delete(keys, string(key))
+				}
+			} else {
+				delete(expected, string(D.Key))
+			}
+			apply(D.Left)
+			apply(D.Right)
+		}
+		apply(D)
+
+		session := NewSession()
+		tD := Difference(t1, D, session)
+
+		actual := make(map[string]map[string]bool)
+		nestedModel(tD, actual)
+		if len(actual) != len(expected) {
+			t.Fatalf("tD has %v keys, expected %v", len(actual), len(expected))
+		}
+		for key, keys := range expected {
+			got, ok := actual[key]
+			if !ok {
+				t.Fatalf("Key: %v not in tD", []byte(key))
+			}
+			if len(got) != len(keys) {
+				t.Fatalf("Key: %v has %v nested keys, expected %v", []byte(key), len(got), len(keys))
+			}
+			for nestedKey := range keys {
+				if !got[nestedKey] {
+					t.Fatalf("Key: %v is missing nested key %v", []byte(key), []byte(nestedKey))
+				}
+			}
+		}
+
+		// Check that tD is balanced
+		if !IsBalanced(tD) {
+			t.Fatalf("tD with root: %v is height unbalanced", tD)
+		}
+
+		// Every re-hash, nested trees included, is of a node created by the difference
+		RootHash(tD, SHA256Hasher, session)
+		if session.Stats().Hashes != session.CountNumberOfNewHashes(tD) {
+			t.Fatalf("recorded %v re-hashes, tD has %v new nodes", session.Stats().Hashes, session.CountNumberOfNewHashes(tD))
+		}
+	})
+}
+
+func TestApplyReplace(t *testing.T) {
+	pool := *(EmbedByteArray([]byte{100, 101, 102, 103, 104, 105, 106, 107, 108, 109, 110, 111, 112, 113, 114, 115}))
+	b1 := *(EmbedByteArray([]byte{1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15, 16}))
+	t1 := BuildTreeFromInorder(&b1)
+	nestPool(t1, pool, new(int))
+	if len(nestedKeys(t1, b1[0])) == 0 {
+		t.Fatalf("key %v has no nested tree to replace", b1[0])
+	}
+
+	// A replaced key only keeps the nested updates of the entry, whether it was in the tree or not
+	replaced := NewDictNode(b1[0], []byte{1}, 2, nil, NewDictNode([]byte{20}, []byte{2}, 1, nil, nil))
+	replaced.Op = OpReplace
+	replaced.Update = NewDictNode([]byte{7}, []byte{7}, 1, nil, nil)
+	replaced.Delete = NewDictNode(pool[0], nil, 1, nil, nil)
+	replaced.Right.Op = OpReplace
+	replaced.Right.Update = NewDictNode([]byte{8}, []byte{8}, 1, nil, nil)
+
+	T := Apply(t1, replaced, nil)
+	for _, k := range [][]byte{b1[0], {20}} {
+		if v, _ := Get(T, k, nil); !bytes.Equal(v, findDict(replaced, k).Value) {
+			t.Fatalf("key %v has value %v, expected the value of the entry", k, v)
+		}
+		keys := nestedKeys(T, k)
+		if len(keys) != 1 || !bytes.Equal(keys[0], findDict(replaced, k).Update.Key) {
+			t.Fatalf("key %v holds %v, expected only the nested updates of the entry", k, keys)
+		}
+	}
+	if len(*(GetInorderTraversal(T))) != len(b1)+1 {
+		t.Fatalf("T has %v keys, expected %v", len(*(GetInorderTraversal(T))), len(b1)+1)
+	}
+}
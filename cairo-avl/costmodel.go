@@ -0,0 +1,104 @@
+package cairo_avl
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+)
+
+// EventWeight is the cost of a single occurrence of an event, in Cairo steps and L1 gas
+type EventWeight struct {
+	Steps float64 `json:"steps"`
+	Gas   float64 `json:"gas"`
+}
+
+// CostModel assigns a weight to each event type recorded in Stats
+// Exposed and height taken nodes pay for authenticating a pre-existing node, Hash pays for each commitment computed by RootHash
+// An illustrative model has made-up weights, its estimates only compare operations with each other
+type CostModel struct {
+	Name         string      `json:"name"`
+	Illustrative bool        `json:"illustrative,omitempty"`
+	Exposed      EventWeight `json:"exposed"`
+	HeightTaken  EventWeight `json:"height_taken"`
+	Created      EventWeight `json:"created"`
+	Hash         EventWeight `json:"hash"`
+	Rotation     EventWeight `json:"rotation"`
+	Split        EventWeight `json:"split"`
+	Join         EventWeight `json:"join"`
+}
+
+// Cost is the estimated cost of an operation
+type Cost struct {
+	Steps float64
+	Gas   float64
+}
+
+// The presets are illustrative, their weights are not measured on any Cairo version or network: they assume a node
+// commitment hashes 7 felts, which takes 8 Pedersen builtin applications through compute_hash_on_elements and 4 Poseidon
+// permutations through poseidon_hash_many, and charge a made-up 0.32 gas for each builtin application and 0.01 gas for each
+// step. Real estimates need a model measured for the target network, read with ParseCostModel
+var (
+	PedersenCostModel = &CostModel{
+		Name:         "pedersen",
+		Illustrative: true,
+		Exposed:      EventWeight{Steps: 90, Gas: 3.46},
+		HeightTaken:  EventWeight{Steps: 80, Gas: 3.36},
+		Created:      EventWeight{Steps: 10, Gas: 0.1},
+		Hash:         EventWeight{Steps: 70, Gas: 3.26},
+		Rotation:     EventWeight{Steps: 30, Gas: 0.3},
+		Split:        EventWeight{Steps: 25, Gas: 0.25},
+		Join:         EventWeight{Steps: 25, Gas: 0.25},
+	}
+	PoseidonCostModel = &CostModel{
+		Name:         "poseidon",
+		Illustrative: true,
+		Exposed:      EventWeight{Steps: 60, Gas: 1.88},
+		HeightTaken:  EventWeight{Steps: 50, Gas: 1.78},
+		Created:      EventWeight{Steps: 10, Gas: 0.1},
+		Hash:         EventWeight{Steps: 40, Gas: 1.68},
+		Rotation:     EventWeight{Steps: 30, Gas: 0.3},
+		Split:        EventWeight{Steps: 25, Gas: 0.25},
+		Join:         EventWeight{Steps: 25, Gas: 0.25},
+	}
+)
+
+// CostModels lists every built-in cost model
+var CostModels = []*CostModel{PedersenCostModel, PoseidonCostModel}
+
+// CostModelByName returns the built-in cost model with the given name
+func CostModelByName(name string) (*CostModel, error) {
+	for _, model := range CostModels {
+		if model.Name == name {
+			return model, nil
+		}
+	}
+	return nil, fmt.Errorf("unknown cost model: %s", name)
+}
+
+// ParseCostModel reads a cost model from JSON, events missing from the JSON weigh nothing and unknown fields are rejected
+func ParseCostModel(b []byte) (*CostModel, error) {
+	decoder := json.NewDecoder(bytes.NewReader(b))
+	decoder.DisallowUnknownFields()
+	model := &CostModel{}
+	if err := decoder.Decode(model); err != nil {
+		return nil, err
+	}
+	return model, nil
+}
+
+// Estimate weighs every event of an operation and sums them up
+func (m *CostModel) Estimate(stats Stats) Cost {
+	var cost Cost
+	add := func(count int, weight EventWeight) {
+		cost.Steps += float64(count) * weight.Steps
+		cost.Gas += float64(count) * weight.Gas
+	}
+	add(stats.ExposedNodes, m.Exposed)
+	add(stats.HeightTakenNodes, m.HeightTaken)
+	add(stats.CreatedNodes, m.Created)
+	add(stats.Hashes, m.Hash)
+	add(stats.Rotations, m.Rotation)
+	add(stats.Splits, m.Split)
+	add(stats.Joins, m.Join)
+	return cost
+}
@@ -0,0 +1,52 @@
+package cairo_avl
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestEstimateWeighsEveryEvent(t *testing.T) {
+	model := &CostModel{
+		Exposed:     EventWeight{Steps: 1, Gas: 0.5},
+		HeightTaken: EventWeight{Steps: 2},
+		Created:     EventWeight{Steps: 3},
+		Hash:        EventWeight{Steps: 4, Gas: 1},
+		Rotation:    EventWeight{Steps: 5},
+		Split:       EventWeight{Steps: 6},
+		Join:        EventWeight{Steps: 7},
+	}
+	stats := Stats{ExposedNodes: 1, HeightTakenNodes: 1, CreatedNodes: 1, Hashes: 2, Rotations: 1, Splits: 1, Joins: 1}
+
+	cost := model.Estimate(stats)
+	if cost.Steps != 32 || cost.Gas != 2.5 {
+		t.Fatalf("estimated %+v, expected 32 steps and 2.5 gas", cost)
+	}
+}
+
+func TestParseCostModel(t *testing.T) {
+	for _, preset := range CostModels {
+		b, err := json.Marshal(preset)
+		if err != nil {
+			t.Fatalf("could not encode %s: %v", preset.Name, err)
+		}
+		model, err := ParseCostModel(b)
+		if err != nil {
+			t.Fatalf("could not parse %s: %v", preset.Name, err)
+		}
+		if *model != *preset {
+			t.Fatalf("%s changed through JSON: %+v", preset.Name, model)
+		}
+	}
+
+	model, err := ParseCostModel([]byte(`{"name": "custom", "hash": {"steps": 10, "gas": 1}}`))
+	if err != nil {
+		t.Fatalf("could not parse a partial model: %v", err)
+	}
+	if cost := model.Estimate(Stats{Hashes: 3, ExposedNodes: 5}); cost.Steps != 30 || cost.Gas != 3 {
+		t.Fatalf("partial model estimated %+v", cost)
+	}
+
+	if _, err := ParseCostModel([]byte(`{"hashes": {"steps": 10}}`)); err == nil {
+		t.Fatalf("a model with an unknown event was accepted")
+	}
+}
@@ -1,5 +1,18 @@
 package cairo_avl
 
+// Op is the kind of change a DictNode entry makes to a tree in Apply
+type Op int
+
+const (
+	// OpUpsert inserts the key, or replaces its value if it is already in the tree
+	OpUpsert Op = iota
+	// OpDelete removes the key and its nested tree
+	OpDelete
+	// OpReplace inserts the key with its value and a nested tree built from its nested updates alone, dropping the
+	// nested tree it had, as deleting the key and then upserting it would
+	OpReplace
+)
+
 // DictNode dict representation of the data in a TreeNode object format
 type DictNode struct {
 	Key    []byte
@@ -8,6 +21,7 @@ type DictNode struct {
 	Right  *DictNode
 	Update *DictNode
 	Delete *DictNode
+	Op     Op
 	Height int
 	Path   string
 }
@@ -26,10 +40,17 @@ func NewDictNode(key []byte, value []byte, h int, left, right *DictNode) *DictNo
 }
 
 func (d *DictNode) ConvertToNode() *Node {
+	return d.convertToNode(nopTracker{})
+}
+
+// convertToNode converts a dict tree into new nodes on behalf of an operation, the nested updates of each key become its
+// nested tree
+func (d *DictNode) convertToNode(tracker CostTracker) *Node {
 	if d == nil {
 		return nil
 	}
-	return NewNode(d.Key, d.Value, d.Height, d.Left.ConvertToNode(), d.Right.ConvertToNode(), nil)
+	return newNode(d.Key, d.Value, d.Height, d.Left.convertToNode(tracker), d.Right.convertToNode(tracker),
+		d.Update.convertToNode(nest(tracker)), tracker)
 }
 
 // exposeDict opens up a dict type
@@ -62,3 +83,27 @@ func BuildDictTreeFromInorder(arr *[][]byte) *DictNode {
 	}
 	return root
 }
+
+// keys returns the keys of a dict tree in order
+func (d *DictNode) keys() [][]byte {
+	if d == nil {
+		return nil
+	}
+	return append(append(d.Left.keys(), d.Key), d.Right.keys()...)
+}
+
+// hasDeletes reports whether any entry of a dict tree is a deletion
+func (d *DictNode) hasDeletes() bool {
+	if d == nil {
+		return false
+	}
+	return d.Op == OpDelete || d.Left.hasDeletes() || d.Right.hasDeletes()
+}
+
+// entries returns the entries of a dict tree in order
+func (d *DictNode) entries() []*DictNode {
+	if d == nil {
+		return nil
+	}
+	return append(append(d.Left.entries(), d), d.Right.entries()...)
+}
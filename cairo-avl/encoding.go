@@ -0,0 +1,111 @@
+package cairo_avl
+
+import (
+	"encoding/binary"
+	"errors"
+)
+
+// ErrMalformedEncoding is returned when decoding runs out of bytes or meets an unknown tag
+var ErrMalformedEncoding = errors.New("malformed encoding")
+
+// appendBytes appends a byte string prefixed with its length
+func appendBytes(buf []byte, b []byte) []byte {
+	var length [4]byte
+	binary.BigEndian.PutUint32(length[:], uint32(len(b)))
+	buf = append(buf, length[:]...)
+	return append(buf, b...)
+}
+
+// appendInt appends an integer as a fixed size big endian value
+func appendInt(buf []byte, n int) []byte {
+	return append(buf, encodeHeight(n)...)
+}
+
+// decoder reads back the values written by appendBytes and appendInt
+type decoder struct {
+	buf []byte
+	err error
+}
+
+func (d *decoder) readByte() byte {
+	if d.err != nil || len(d.buf) < 1 {
+		d.err = ErrMalformedEncoding
+		return 0
+	}
+	b := d.buf[0]
+	d.buf = d.buf[1:]
+	return b
+}
+
+func (d *decoder) readBytes() []byte {
+	if d.err != nil || len(d.buf) < 4 {
+		d.err = ErrMalformedEncoding
+		return nil
+	}
+	n := binary.BigEndian.Uint32(d.buf)
+	if uint64(len(d.buf)-4) < uint64(n) {
+		d.err = ErrMalformedEncoding
+		return nil
+	}
+	b := d.buf[4 : 4+n]
+	d.buf = d.buf[4+n:]
+	return b
+}
+
+func (d *decoder) readInt() int {
+	if d.err != nil || len(d.buf) < 8 {
+		d.err = ErrMalformedEncoding
+		return 0
+	}
+	n := int(binary.BigEndian.Uint64(d.buf))
+	d.buf = d.buf[8:]
+	return n
+}
+
+// appendDict appends a dict tree in pre-order, each entry after a tag byte that is 0 for an empty subtree and tells
+// whether the entry has a value, since an entry without one keeps the value of its key
+func appendDict(buf []byte, d *DictNode) []byte {
+	if d == nil {
+		return append(buf, 0)
+	}
+	if d.Value == nil {
+		buf = append(buf, 1)
+		buf = appendBytes(buf, d.Key)
+	} else {
+		buf = append(buf, 2)
+		buf = appendBytes(buf, d.Key)
+		buf = appendBytes(buf, d.Value)
+	}
+	buf = appendInt(buf, int(d.Op))
+	buf = appendInt(buf, d.Height)
+	buf = appendDict(buf, d.Left)
+	buf = appendDict(buf, d.Right)
+	buf = appendDict(buf, d.Update)
+	return appendDict(buf, d.Delete)
+}
+
+// readDict reads back a dict tree written by appendDict
+func (d *decoder) readDict() *DictNode {
+	tag := d.readByte()
+	if tag > 2 {
+		d.err = ErrMalformedEncoding
+	}
+	if tag == 0 || d.err != nil {
+		return nil
+	}
+	entry := &DictNode{Key: d.readBytes()}
+	if tag == 2 {
+		entry.Value = d.readBytes()
+	}
+	entry.Op = Op(d.readInt())
+	if entry.Op < OpUpsert || entry.Op > OpReplace {
+		d.err = ErrMalformedEncoding
+		return nil
+	}
+	entry.Height = d.readInt()
+	entry.Left = d.readDict()
+	entry.Right = d.readDict()
+	entry.Update = d.readDict()
+	entry.Delete = d.readDict()
+	return entry
+}
@@ -0,0 +1,197 @@
+package cairo_avl
+
+import (
+	"errors"
+	"math/big"
+	"math/bits"
+)
+
+// ErrNotFelt is returned when a hasher input is longer than 32 bytes or not smaller than the STARK prime
+var ErrNotFelt = errors.New("input is not a field element")
+
+// felt is an element of the STARK field, stored in Montgomery form as four little endian 64 bit limbs
+type felt [4]uint64
+
+// starkPrime is the size of the STARK field, 2^251 + 17*2^192 + 1
+var starkPrime, _ = new(big.Int).SetString("800000000000011000000000000000000000000000000000000000000000001", 16)
+
+var (
+	feltModulus = felt{1, 0, 0, 0x0800000000000011}
+	// feltRSquare is 2^512 mod p, used to move raw limbs into Montgomery form
+	feltRSquare = rawFelt(new(big.Int).Exp(big.NewInt(2), big.NewInt(512), starkPrime))
+	// feltOne is the element 1 in Montgomery form
+	feltOne = newFelt(big.NewInt(1))
+)
+
+// feltInvNeg is -p^-1 mod 2^64, the lowest limb of p is 1 so its inverse is 1
+const feltInvNeg = ^uint64(0)
+
+// rawFelt stores a reduced integer in limbs without converting it to Montgomery form
+func rawFelt(b *big.Int) felt {
+	var z felt
+	words := new(big.Int).Mod(b, starkPrime).Bits()
+	if bits.UintSize == 64 {
+		for i := 0; i < len(words); i++ {
+			z[i] = uint64(words[i])
+		}
+	} else {
+		for i := 0; i < len(words); i++ {
+			z[i/2] |= uint64(words[i]) << (32 * uint(i%2))
+		}
+	}
+	return z
+}
+
+// newFelt maps an integer to an element of the STARK field
+func newFelt(b *big.Int) felt {
+	return rawFelt(b).mul(feltRSquare)
+}
+
+// checkFelt returns ErrNotFelt unless a big endian byte string is an element of the STARK field as it is
+// Inputs are never reduced, since that would map distinct inputs to the same element
+func checkFelt(b []byte) error {
+	if len(b) > 32 || new(big.Int).SetBytes(b).Cmp(starkPrime) >= 0 {
+		return ErrNotFelt
+	}
+	return nil
+}
+
+// toFelt interprets a big endian byte string as an element of the STARK field, panicking with ErrNotFelt when it is not
+// one, callers check keys and values with checkFelt first
+func toFelt(b []byte) felt {
+	if err := checkFelt(b); err != nil {
+		panic(err)
+	}
+	return newFelt(new(big.Int).SetBytes(b))
+}
+
+// feltInputs maps hasher inputs to field elements, followed by the element whose big endian bytes are the byte
+// lengths of the inputs, so that inputs differing only by leading zero bytes hash differently
+func feltInputs(inputs [][]byte) []felt {
+	lengths := make([]byte, len(inputs))
+	elements := make([]felt, 0, len(inputs)+1)
+	for i, input := range inputs {
+		lengths[i] = byte(len(input))
+		elements = append(elements, toFelt(input))
+	}
+	return append(elements, toFelt(lengths))
+}
+
+// recoverNotFelt turns a panic on a hasher input that is not a field element into ErrNotFelt
+func recoverNotFelt(err *error) {
+	if r := recover(); r != nil {
+		if r != ErrNotFelt {
+			panic(r)
+		}
+		*err = ErrNotFelt
+	}
+}
+
+// big returns the canonical integer representation of a field element
+func (x felt) big() *big.Int {
+	raw := x.mul(felt{1, 0, 0, 0})
+	b := new(big.Int)
+	for i := 3; i >= 0; i-- {
+		b.Lsh(b, 64)
+		b.Or(b, new(big.Int).SetUint64(raw[i]))
+	}
+	return b
+}
+
+// bytes encodes a field element as a 32 byte big endian string
+func (x felt) bytes() []byte {
+	b := make([]byte, 32)
+	return x.big().FillBytes(b)
+}
+
+func (x felt) isZero() bool {
+	return x[0]|x[1]|x[2]|x[3] == 0
+}
+
+// reduce subtracts the modulus once if x is not smaller than it
+func (x felt) reduce() felt {
+	var z felt
+	var borrow uint64
+	z[0], borrow = bits.Sub64(x[0], feltModulus[0], 0)
+	z[1], borrow = bits.Sub64(x[1], feltModulus[1], borrow)
+	z[2], borrow = bits.Sub64(x[2], feltModulus[2], borrow)
+	z[3], borrow = bits.Sub64(x[3], feltModulus[3], borrow)
+	if borrow != 0 {
+		return x
+	}
+	return z
+}
+
+func (x felt) add(y felt) felt {
+	var z felt
+	var carry uint64
+	z[0], carry = bits.Add64(x[0], y[0], 0)
+	z[1], carry = bits.Add64(x[1], y[1], carry)
+	z[2], carry = bits.Add64(x[2], y[2], carry)
+	z[3], _ = bits.Add64(x[3], y[3], carry)
+	return z.reduce()
+}
+
+func (x felt) sub(y felt) felt {
+	var z felt
+	var borrow uint64
+	z[0], borrow = bits.Sub64(x[0], y[0], 0)
+	z[1], borrow = bits.Sub64(x[1], y[1], borrow)
+	z[2], borrow = bits.Sub64(x[2], y[2], borrow)
+	z[3], borrow = bits.Sub64(x[3], y[3], borrow)
+	if borrow != 0 {
+		var carry uint64
+		z[0], carry = bits.Add64(z[0], feltModulus[0], 0)
+		z[1], carry = bits.Add64(z[1], feltModulus[1], carry)
+		z[2], carry = bits.Add64(z[2], feltModulus[2], carry)
+		z[3], _ = bits.Add64(z[3], feltModulus[3], carry)
+	}
+	return z
+}
+
+// mul returns the Montgomery product x * y * 2^-256 mod p
+func (x felt) mul(y felt) felt {
+	var t [6]uint64
+	for i := 0; i < 4; i++ {
+		var c uint64
+		for j := 0; j < 4; j++ {
+			hi, lo := bits.Mul64(x[j], y[i])
+			var carry uint64
+			lo, carry = bits.Add64(lo, t[j], 0)
+			hi += carry
+			lo, carry = bits.Add64(lo, c, 0)
+			hi += carry
+			t[j] = lo
+			c = hi
+		}
+		var carry uint64
+		t[4], carry = bits.Add64(t[4], c, 0)
+		t[5] = carry
+
+		m := t[0] * feltInvNeg
+		hi, lo := bits.Mul64(m, feltModulus[0])
+		_, carry = bits.Add64(lo, t[0], 0)
+		c = hi + carry
+		for j := 1; j < 4; j++ {
+			hi, lo = bits.Mul64(m, feltModulus[j])
+			lo, carry = bits.Add64(lo, t[j], 0)
+			hi += carry
+			lo, carry = bits.Add64(lo, c, 0)
+			hi += carry
+			t[j-1] = lo
+			c = hi
+		}
+		t[3], carry = bits.Add64(t[4], c, 0)
+		t[4] = t[5] + carry
+	}
+	return felt{t[0], t[1], t[2], t[3]}.reduce()
+}
+
+func (x felt) square() felt {
+	return x.mul(x)
+}
+
+// inverse returns the multiplicative inverse of a non zero element
+func (x felt) inverse() felt {
+	return newFelt(new(big.Int).ModInverse(x.big(), starkPrime))
+}
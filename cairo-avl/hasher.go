@@ -0,0 +1,83 @@
+package cairo_avl
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"hash"
+
+	"golang.org/x/crypto/blake2b"
+	"golang.org/x/crypto/sha3"
+)
+
+// Hasher computes the commitment of a node from the ordered list of its encoded fields
+type Hasher interface {
+	// Name returns a short identifier of the hash function
+	Name() string
+	// Hash returns the digest of the ordered inputs
+	Hash(inputs ...[]byte) []byte
+	// Check returns an error when the hasher cannot commit to an input as the key or the value of a node
+	Check(input []byte) error
+}
+
+// byteHasher adapts a standard library hash constructor to the Hasher interface
+type byteHasher struct {
+	name    string
+	newHash func() hash.Hash
+}
+
+func (b *byteHasher) Name() string {
+	return b.name
+}
+
+// Hash writes every input prefixed with its length so that different field splits never collide
+func (b *byteHasher) Hash(inputs ...[]byte) []byte {
+	h := b.newHash()
+	var length [4]byte
+	for _, input := range inputs {
+		binary.BigEndian.PutUint32(length[:], uint32(len(input)))
+		h.Write(length[:])
+		h.Write(input)
+	}
+	return h.Sum(nil)
+}
+
+// Check accepts any input, every byte string has a length prefixed encoding
+func (b *byteHasher) Check([]byte) error {
+	return nil
+}
+
+func newBlake2b256() hash.Hash {
+	h, err := blake2b.New256(nil)
+	handleError(err)
+	return h
+}
+
+var (
+	// SHA256Hasher commits nodes with SHA-256
+	SHA256Hasher Hasher = &byteHasher{name: "sha256", newHash: sha256.New}
+	// Keccak256Hasher commits nodes with the legacy Keccak-256 used by Ethereum
+	Keccak256Hasher Hasher = &byteHasher{name: "keccak256", newHash: sha3.NewLegacyKeccak256}
+	// Blake2bHasher commits nodes with BLAKE2b-256
+	Blake2bHasher Hasher = &byteHasher{name: "blake2b", newHash: newBlake2b256}
+)
+
+// Hashers lists every built-in hasher
+var Hashers = []Hasher{SHA256Hasher, Keccak256Hasher, Blake2bHasher, PedersenHasher, PoseidonHasher}
+
+// HasherByName returns the built-in hasher with the given name
+func HasherByName(name string) (Hasher, error) {
+	for _, hasher := range Hashers {
+		if hasher.Name() == name {
+			return hasher, nil
+		}
+	}
+	return nil, fmt.Errorf("unknown hasher: %s", name)
+}
+
+// encodeHeight encodes the height of a node as a fixed size big endian integer
+func encodeHeight(h int) []byte {
+	var b [8]byte
+	binary.BigEndian.PutUint64(b[:], uint64(h))
+	return b[:]
+}
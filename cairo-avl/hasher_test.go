@@ -0,0 +1,150 @@
+package cairo_avl
+
+import (
+	"bytes"
+	"testing"
+)
+
+func clearHashes(root *Node) {
+	if root == nil {
+		return
+	}
+	root.commitments = nil
+	clearHashes(root.Left)
+	clearHashes(root.Right)
+	clearHashes(root.Nested)
+}
+
+func TestRootHashOnlyRehashesNewNodes(t *testing.T) {
+	input1 := []byte{1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15, 16, 17, 18, 19, 20, 21, 22, 23, 24}
+	input2 := []byte{3, 4, 5, 7, 30, 31, 32, 33, 40, 41, 42, 43}
+
+	for _, hasher := range []Hasher{SHA256Hasher, Keccak256Hasher, Blake2bHasher} {
+		b1 := *(EmbedByteArray(input1))
+		b2 := *(EmbedByteArray(input2))
+
+		t1 := BuildTreeFromInorder(&b1)
+		D := BuildDictTreeFromInorder(&b2)
+		RootHash(t1, hasher, nil)
+
+		session := NewSession()
+		tU := Union(t1, D, session)
+
+		hashing := NewSession()
+		root := RootHash(tU, hasher, hashing)
+		numOfHashes := hashing.Stats().Hashes
+
+		newNodesCount := session.CountNumberOfNewHashes(tU)
+		if numOfHashes != newNodesCount {
+			t.Fatalf("%s: computed %v hashes, expected %v", hasher.Name(), numOfHashes, newNodesCount)
+		}
+
+		clearHashes(tU)
+		if !bytes.Equal(root, RootHash(tU, hasher, nil)) {
+			t.Fatalf("%s: lazily computed root differs from a full recomputation", hasher.Name())
+		}
+	}
+}
+
+func TestRootHashWithAnotherHasher(t *testing.T) {
+	b := *(EmbedByteArray([]byte{1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15, 16, 17, 18, 19, 20}))
+	t1 := BuildTreeFromInorder(&b)
+	sha := RootHash(t1, SHA256Hasher, nil)
+
+	// Committing the same tree with another hasher recomputes every commitment instead of returning the cached ones
+	pedersen := RootHash(t1, PedersenHasher, nil)
+	clearHashes(t1)
+	if !bytes.Equal(pedersen, RootHash(t1, PedersenHasher, nil)) {
+		t.Fatalf("pedersen root over cached sha256 commitments differs from a full recomputation")
+	}
+	proof := Prove(t1, b[0], PedersenHasher)
+	if found, err := Verify(pedersen, b[0], proof, PedersenHasher); err != nil || !found {
+		t.Fatalf("pedersen proof failed to verify: %v", err)
+	}
+	if !bytes.Equal(sha, RootHash(t1, SHA256Hasher, nil)) {
+		t.Fatalf("sha256 root changed after committing with pedersen")
+	}
+}
+
+func TestWitnessAfterHashingWithTwoHashers(t *testing.T) {
+	b1 := *(EmbedByteArray([]byte{1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15, 16, 17, 18, 19, 20}))
+	b2 := *(EmbedByteArray([]byte{5, 6, 7, 8, 1, 1, 1, 1, 13, 14, 15, 16}))
+	t1 := BuildTreeFromInorder(&b1)
+	D := BuildDictTreeFromInorder(&b2)
+	oldRoot := RootHash(t1, SHA256Hasher, nil)
+
+	session := NewSession()
+	tU := Union(t1, D, session)
+
+	// Committing another version of t1 with another hasher leaves the sha256 commitments of the subtrees they share in place
+	b3 := *(EmbedByteArray([]byte{0, 0, 0, 1}))
+	RootHash(Union(t1, BuildDictTreeFromInorder(&b3), nil), PedersenHasher, nil)
+	w := BuildWitness(t1, tU, session, SHA256Hasher)
+	for _, node := range w.Nodes {
+		if !bytes.Equal(node.Hash, hashNode(SHA256Hasher, node.Key, node.Value, node.Height, node.Left, node.Right, node.Nested)) {
+			t.Fatalf("Key: %v has a witness commitment that does not match its fields", node.Key)
+		}
+	}
+	if _, err := VerifyUnion(oldRoot, D, w, SHA256Hasher); err != nil {
+		t.Fatalf("replay failed: %v", err)
+	}
+}
+
+func TestRootHashOfVersionsSharingNodes(t *testing.T) {
+	b1 := *(EmbedByteArray([]byte{1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15, 16, 17, 18, 19, 20}))
+	b2 := *(EmbedByteArray([]byte{5, 6, 7, 8, 1, 1, 1, 1, 13, 14, 15, 16}))
+	t1 := BuildTreeFromInorder(&b1)
+	tU := Union(t1, BuildDictTreeFromInorder(&b2), nil)
+
+	// Both versions are hashed at once, with different hashers, through the nodes they share
+	hashers := []Hasher{SHA256Hasher, Keccak256Hasher}
+	roots := make([][]byte, len(hashers))
+	done := make(chan bool)
+	for i, hasher := range hashers {
+		go func(i int, hasher Hasher) {
+			RootHash(t1, hasher, nil)
+			roots[i] = RootHash(tU, hasher, nil)
+			done <- true
+		}(i, hasher)
+	}
+	for range hashers {
+		<-done
+	}
+
+	for i, hasher := range hashers {
+		expected := Union(BuildTreeFromInorder(&b1), BuildDictTreeFromInorder(&b2), nil)
+		if !bytes.Equal(roots[i], RootHash(expected, hasher, nil)) {
+			t.Fatalf("%s root hashed concurrently differs from a fresh tree", hasher.Name())
+		}
+	}
+}
+
+func TestCommitRejectsNonFelts(t *testing.T) {
+	b := *(EmbedByteArray([]byte{1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12}))
+	t1 := BuildTreeFromInorder(&b)
+	t2 := Put(t1, []byte{5, 6, 7, 8}, make([]byte, 40), nil)
+
+	for _, hasher := range []Hasher{PedersenHasher, PoseidonHasher} {
+		if _, err := Commit(t2, hasher, nil); err != ErrNotFelt {
+			t.Fatalf("%s: committing a 40 byte value returned %v", hasher.Name(), err)
+		}
+		if _, err := Commit(t1, hasher, nil); err != nil {
+			t.Fatalf("%s: could not commit the tree of field elements: %v", hasher.Name(), err)
+		}
+	}
+	if _, err := Commit(t2, SHA256Hasher, nil); err != nil {
+		t.Fatalf("sha256 rejected a 40 byte value: %v", err)
+	}
+}
+
+func TestRootHashCoversValues(t *testing.T) {
+	b := *(EmbedByteArray([]byte{1, 2, 3, 4, 5, 6, 7, 8}))
+	t1 := BuildTreeFromInorder(&b)
+	h1 := RootHash(t1, SHA256Hasher, nil)
+
+	t1.Left.Value = []byte{9}
+	clearHashes(t1)
+	if bytes.Equal(h1, RootHash(t1, SHA256Hasher, nil)) {
+		t.Fatalf("root hash did not change after a value update")
+	}
+}
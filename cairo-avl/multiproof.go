@@ -0,0 +1,174 @@
+package cairo_avl
+
+import (
+	"bytes"
+	"sort"
+)
+
+// MultiProofNode is an entry of a multiproof, entries are listed in pre-order
+// An opened node carries its fields and is followed by the entries of its left and right subtrees,
+// a pruned subtree only carries its commitment, which is empty for a missing child
+type MultiProofNode struct {
+	Opened bool
+	Key    []byte
+	Value  []byte
+	Height int
+	Nested []byte
+	Hash   []byte
+}
+
+// MultiProof proves a sorted set of keys at once, every node shared by their search paths is opened only once
+type MultiProof struct {
+	Nodes []MultiProofNode
+}
+
+// partitionKeys splits sorted keys into those smaller than k, whether k is present, and those greater than k
+func partitionKeys(keys [][]byte, k []byte) ([][]byte, bool, [][]byte) {
+	i := sort.Search(len(keys), func(i int) bool {
+		return bytes.Compare(keys[i], k) != -1
+	})
+	if i < len(keys) && bytes.Equal(keys[i], k) {
+		return keys[:i], true, keys[i+1:]
+	}
+	return keys[:i], false, keys[i:]
+}
+
+// ProveMulti opens the union of the search paths of sorted keys and prunes every other subtree to its commitment
+func ProveMulti(root *Node, keys [][]byte, hasher Hasher) *MultiProof {
+	proof := &MultiProof{}
+	proveMulti(root, keys, hasher, proof)
+	return proof
+}
+
+func proveMulti(root *Node, keys [][]byte, hasher Hasher, proof *MultiProof) {
+	if root == nil || len(keys) == 0 {
+		proof.Nodes = append(proof.Nodes, MultiProofNode{Hash: RootHash(root, hasher, nil)})
+		return
+	}
+	proof.Nodes = append(proof.Nodes, MultiProofNode{
+		Opened: true,
+		Key:    root.Key,
+		Value:  root.Value,
+		Height: root.Height,
+		Nested: RootHash(root.Nested, hasher, nil),
+	})
+	leftKeys, _, rightKeys := partitionKeys(keys, root.Key)
+	proveMulti(root.Left, leftKeys, hasher, proof)
+	proveMulti(root.Right, rightKeys, hasher, proof)
+}
+
+// ProveBatch proves every key of a dictionary batch against a tree
+func ProveBatch(root *Node, D *DictNode, hasher Hasher) *MultiProof {
+	return ProveMulti(root, D.keys(), hasher)
+}
+
+// VerifyMulti rebuilds the root hash from a multiproof and reports, for each of the sorted keys, whether it is in the tree
+func VerifyMulti(rootHash []byte, keys [][]byte, proof *MultiProof, hasher Hasher) (result []bool, err error) {
+	defer recoverNotFelt(&err)
+	found := make(map[string]bool)
+	next := 0
+	hash, err := verifyMulti(keys, proof, hasher, &next, found)
+	if err != nil {
+		return nil, err
+	}
+	if next != len(proof.Nodes) || !bytes.Equal(hash, rootHash) {
+		return nil, ErrInvalidProof
+	}
+
+	result = make([]bool, len(keys))
+	for i, key := range keys {
+		result[i] = found[string(key)]
+	}
+	return result, nil
+}
+
+// verifyMulti consumes the entries of one subtree and returns its commitment
+func verifyMulti(keys [][]byte, proof *MultiProof, hasher Hasher, next *int, found map[string]bool) ([]byte, error) {
+	if *next >= len(proof.Nodes) {
+		return nil, ErrInvalidProof
+	}
+	entry := &proof.Nodes[*next]
+	*next++
+
+	if !entry.Opened {
+		// Keys can only fall into a pruned subtree when it is empty, which proves their absence
+		if len(keys) != 0 && len(entry.Hash) != 0 {
+			return nil, ErrInvalidProof
+		}
+		return entry.Hash, nil
+	}
+
+	leftKeys, present, rightKeys := partitionKeys(keys, entry.Key)
+	if present {
+		found[string(entry.Key)] = true
+	}
+	left, err := verifyMulti(leftKeys, proof, hasher, next, found)
+	if err != nil {
+		return nil, err
+	}
+	right, err := verifyMulti(rightKeys, proof, hasher, next, found)
+	if err != nil {
+		return nil, err
+	}
+	return hashNode(hasher, entry.Key, entry.Value, entry.Height, left, right, entry.Nested), nil
+}
+
+// Encode serialises a multiproof, an opened entry is tagged 1 and a pruned one 0
+func (p *MultiProof) Encode() []byte {
+	var buf []byte
+	for _, entry := range p.Nodes {
+		if !entry.Opened {
+			buf = append(buf, 0)
+			buf = appendBytes(buf, entry.Hash)
+			continue
+		}
+		buf = append(buf, 1)
+		buf = appendBytes(buf, entry.Key)
+		buf = appendBytes(buf, entry.Value)
+		buf = appendInt(buf, entry.Height)
+		buf = appendBytes(buf, entry.Nested)
+	}
+	return buf
+}
+
+// DecodeMultiProof reads back a multiproof serialised with Encode
+func DecodeMultiProof(b []byte) (*MultiProof, error) {
+	d := &decoder{buf: b}
+	proof := &MultiProof{}
+	for len(d.buf) > 0 && d.err == nil {
+		var entry MultiProofNode
+		switch d.readByte() {
+		case 0:
+			entry.Hash = d.readBytes()
+		case 1:
+			entry.Opened = true
+			entry.Key = d.readBytes()
+			entry.Value = d.readBytes()
+			entry.Height = d.readInt()
+			entry.Nested = d.readBytes()
+		default:
+			return nil, ErrMalformedEncoding
+		}
+		proof.Nodes = append(proof.Nodes, entry)
+	}
+	if d.err != nil {
+		return nil, d.err
+	}
+	return proof, nil
+}
+
+// Size returns the number of bytes of the serialised proof
+func (p *MultiProof) Size() int {
+	return len(p.Encode())
+}
+
+// NumOfOpenedNodes returns the number of nodes whose fields the proof reveals
+func (p *MultiProof) NumOfOpenedNodes() int {
+	count := 0
+	for _, entry := range p.Nodes {
+		if entry.Opened {
+			count++
+		}
+	}
+	return count
+}
@@ -0,0 +1,56 @@
+package cairo_avl
+
+import (
+	"testing"
+)
+
+func FuzzProveBatch(f *testing.F) {
+	f.Add([]byte{1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15, 16}, []byte{5, 6, 7, 8, 1, 1, 1, 1, 13, 14, 15, 16})
+
+	f.Fuzz(func(t *testing.T, input1 []byte, input2 []byte) {
+		b1 := *(EmbedByteArray(input1))
+		b2 := *(EmbedByteArray(input2))
+
+		t1 := BuildTreeFromInorder(&b1)
+		D := BuildDictTreeFromInorder(&b2)
+		rootHash := RootHash(t1, SHA256Hasher, nil)
+
+		proof, err := DecodeMultiProof(ProveBatch(t1, D, SHA256Hasher).Encode())
+		if err != nil {
+			t.Fatalf("could not decode the multiproof: %v", err)
+		}
+
+		keys := D.keys()
+		found, err := VerifyMulti(rootHash, keys, proof, SHA256Hasher)
+		if err != nil {
+			t.Fatalf("multiproof failed to verify: %v", err)
+		}
+		for i, key := range keys {
+			if found[i] != IsInTree(t1, &key) {
+				t.Fatalf("Key: %v proved with membership %v", key, found[i])
+			}
+		}
+
+		// Each opened node is on the search path of at least one key, so shared paths are only opened once
+		opened := make(map[string]bool)
+		for _, key := range keys {
+			for _, step := range Prove(t1, key, SHA256Hasher).Steps {
+				opened[string(step.Key)] = true
+			}
+		}
+		if proof.NumOfOpenedNodes() != len(opened) {
+			t.Fatalf("multiproof opened %v nodes, the search paths hold %v", proof.NumOfOpenedNodes(), len(opened))
+		}
+	})
+}
+
+func TestVerifyMultiRejectsUncoveredKeys(t *testing.T) {
+	b := *(EmbedByteArray([]byte{1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15, 16, 17, 18, 19, 20}))
+	t1 := BuildTreeFromInorder(&b)
+	rootHash := RootHash(t1, SHA256Hasher, nil)
+
+	proof := ProveMulti(t1, b[:1], SHA256Hasher)
+	if _, err := VerifyMulti(rootHash, b[len(b)-1:], proof, SHA256Hasher); err != ErrInvalidProof {
+		t.Fatalf("multiproof verified a key it does not cover")
+	}
+}
@@ -2,19 +2,26 @@ package cairo_avl
 
 import (
 	"math"
+	"sync"
 )
 
 // Node node representation of the data in a TreeNode object format
 type Node struct {
-	Key         []byte
-	Value       []byte
-	Left        *Node
-	Right       *Node
-	Nested      *Node
-	Height      int
-	Path        string
-	Exposed     bool
-	HeightTaken bool
+	Key    []byte
+	Value  []byte
+	Left   *Node
+	Right  *Node
+	Nested *Node
+	Height int
+	Path   string
+
+	// commitments caches the commitment of the node for every hasher it was committed with, guarded by mu since the
+	// versions of a persistent tree share nodes and may be hashed concurrently
+	mu          sync.Mutex
+	commitments []commitment
+	// pruned marks a node rebuilt from a witness that only carries its commitment, and its height if heightKnown is set
+	pruned      bool
+	heightKnown bool
 }
 
 // populatePaths attaches node paths from the root of a node down to the node
@@ -37,8 +44,13 @@ func NewNode(key []byte, value []byte, h int, left, right, nested *Node) *Node {
 	node.Right = right
 	node.Nested = nested
 	node.Height = h
-	node.Exposed = true
-	node.HeightTaken = true
+	return node
+}
+
+// newNode creates a node on behalf of an operation and reports it to the tracker
+func newNode(key []byte, value []byte, h int, left, right, nested *Node, tracker CostTracker) *Node {
+	node := NewNode(key, value, h, left, right, nested)
+	tracker.NodeCreated(node)
 	return node
 }
 
@@ -50,17 +62,12 @@ func (n *Node) ConvertToDictNode() *DictNode {
 }
 
 // exposeNode opens up a node type
-func exposeNode(tree *Node, numOfExposedNodes *int, numOfHeightTakenNodes *int) (k []byte, v []byte, TL *Node, TR *Node, TN *Node) {
+func exposeNode(tree *Node, tracker CostTracker) (k []byte, v []byte, TL *Node, TR *Node, TN *Node) {
 	if tree != nil {
-		if !tree.Exposed {
-			if tree.HeightTaken {
-				*numOfHeightTakenNodes--
-			} else {
-				tree.HeightTaken = true
-			}
-			*numOfExposedNodes++
-			tree.Exposed = true
+		if tree.pruned {
+			panic(ErrMissingWitnessNode)
 		}
+		tracker.Expose(tree)
 		return tree.Key, tree.Value, tree.Left, tree.Right, tree.Nested
 	}
 	return []byte{}, []byte{}, nil, nil, nil
@@ -69,23 +76,23 @@ func exposeNode(tree *Node, numOfExposedNodes *int, numOfHeightTakenNodes *int)
 // HeightOf Get height of a node
 // This function exists because the join method can take a null Node pointer
 // and accessing the height property of a null Node pointer will fail
-func HeightOf(node *Node, numOfHeightTakenNodes *int) int {
+// The read is reported to the tracker unless it is nil
+func HeightOf(node *Node, tracker CostTracker) int {
 	if node == nil {
 		return 0
 	}
-	if numOfHeightTakenNodes != nil && !node.Exposed && !node.HeightTaken {
-		*numOfHeightTakenNodes++
+	if node.pruned && !node.heightKnown {
+		panic(ErrMissingWitnessNode)
+	}
+	if tracker != nil {
+		tracker.HeightRead(node)
 	}
-	node.HeightTaken = true
 	return node.Height
 }
 
 // insertNode inserts a node into the tree
 func insertNode(T *Node, k []byte) *Node {
-	numOfExposedNodes := 0
-	numOfHeightTakenNodes := 0
-	TL, TR, TN := split(T, k, &numOfExposedNodes, &numOfHeightTakenNodes)
-	return join(k, k, nil, nil, TL, TR, TN, &numOfExposedNodes, &numOfHeightTakenNodes)
+	return Put(T, k, k, nil)
 }
 
 func _createTree(arr *[][]byte) *Node {
@@ -100,9 +107,7 @@ func BuildTreeFromInorder(arr *[][]byte) *Node {
 	sortArray(arr)
 	n := len(*arr)
 	height := int(math.Floor(math.Log2(float64(n))))
-	root := _buildTreeFromInorder(arr, height+1)
-	setExposureAndHeightTaken(root, false)
-	return root
+	return _buildTreeFromInorder(arr, height+1)
 }
 
 func _buildTreeFromInorder(arr *[][]byte, height int) *Node {
@@ -120,29 +125,92 @@ func _buildTreeFromInorder(arr *[][]byte, height int) *Node {
 	return root
 }
 
-func setExposureAndHeightTaken(root *Node, b bool) {
-	if root == nil {
-		return
+func CreateTree(arr *[][]byte) *Node {
+	return _createTree(arr)
+}
+
+// commitment is the commitment of a node computed by one hasher
+type commitment struct {
+	hasher Hasher
+	hash   []byte
+}
+
+// cachedHash returns the commitment of the node cached for the hasher, nil when it was not committed with it
+func (n *Node) cachedHash(hasher Hasher) []byte {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	for _, c := range n.commitments {
+		if c.hasher == hasher {
+			return c.hash
+		}
 	}
-	setExposureAndHeightTaken(root.Left, b)
-	root.Exposed = false
-	root.HeightTaken = false
-	setExposureAndHeightTaken(root.Right, b)
+	return nil
 }
 
-func CreateTree(arr *[][]byte) *Node {
-	root := _createTree(arr)
-	setExposureAndHeightTaken(root, false)
-	return root
+// cacheHash caches the commitment of the node for the hasher, leaving those of the other hashers in place
+func (n *Node) cacheHash(hasher Hasher, hash []byte) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	for i := range n.commitments {
+		if n.commitments[i].hasher == hasher {
+			n.commitments[i].hash = hash
+			return
+		}
+	}
+	n.commitments = append(n.commitments, commitment{hasher: hasher, hash: hash})
 }
 
-func CountNumberOfNewHashes(root *Node, newNodesCount *int) {
+// RootHash returns the commitment of a tree, covering key, value, height, both children and the nested tree
+// Commitments are cached on the nodes per hasher and only computed for nodes that do not carry one from the same
+// hasher yet. Nodes created by the bulk operations start without a commitment, so once the input tree has been hashed
+// with the same hasher the number of hashes computed here matches the count returned by the CountNumberOfNewHashes of
+// the operation's Session
+// Every computed commitment is reported to the tracker unless it is nil, those of nested trees one nesting level down
+// RootHash panics with the error of the hasher's Check on a key or value it rejects, Commit returns it instead
+func RootHash(root *Node, hasher Hasher, tracker CostTracker) []byte {
+	hash, err := Commit(root, hasher, tracker)
+	if err != nil {
+		panic(err)
+	}
+	return hash
+}
+
+// Commit is RootHash checking the key and value of every node it hashes with the hasher first, and returning the
+// error of a node the hasher rejects, such as ErrNotFelt for a field hasher, before hashing it
+func Commit(root *Node, hasher Hasher, tracker CostTracker) ([]byte, error) {
 	if root == nil {
-		return
+		return nil, nil
+	}
+	if hash := root.cachedHash(hasher); hash != nil {
+		return hash, nil
+	}
+	if err := hasher.Check(root.Key); err != nil {
+		return nil, err
 	}
-	if root.Exposed {
-		*newNodesCount++
+	if err := hasher.Check(root.Value); err != nil {
+		return nil, err
 	}
-	CountNumberOfNewHashes(root.Left, newNodesCount)
-	CountNumberOfNewHashes(root.Right, newNodesCount)
+	left, err := Commit(root.Left, hasher, tracker)
+	if err != nil {
+		return nil, err
+	}
+	right, err := Commit(root.Right, hasher, tracker)
+	if err != nil {
+		return nil, err
+	}
+	nested, err := Commit(root.Nested, hasher, nest(tracker))
+	if err != nil {
+		return nil, err
+	}
+	hash := hashNode(hasher, root.Key, root.Value, root.Height, left, right, nested)
+	root.cacheHash(hasher, hash)
+	if tracker != nil {
+		tracker.Hashed(root)
+	}
+	return hash, nil
+}
+
+// hashNode computes the commitment of a node from its fields and the commitments of its children and nested tree
+func hashNode(hasher Hasher, k []byte, v []byte, h int, left []byte, right []byte, nested []byte) []byte {
+	return hasher.Hash(k, v, encodeHeight(h), left, right, nested)
 }
@@ -0,0 +1,59 @@
+package cairo_avl
+
+// Forker is implemented by trackers that can measure a forked task on their own and merge its events back
+// Merging must give the same result as if the events had been recorded by the tracker itself
+type Forker interface {
+	// Fork returns an empty tracker for a task running concurrently with the tracker
+	Fork() CostTracker
+	// Merge adds the events of a forked tracker once its task is done
+	Merge(forked CostTracker)
+}
+
+// ParallelUnion is Union with the two recursive calls forked on goroutines while D is at least cutoff high
+// The tracker must implement Forker, or be nil, for the calls to be forked, they run sequentially otherwise
+func ParallelUnion(T0 *Node, D *DictNode, tracker CostTracker, cutoff int) *Node {
+	return union(T0, D, orNop(tracker), cutoff)
+}
+
+// ParallelDifference is Difference with the two recursive calls forked on goroutines while D is at least cutoff high
+// The tracker must implement Forker, or be nil, for the calls to be forked, they run sequentially otherwise
+func ParallelDifference(T0 *Node, D *DictNode, tracker CostTracker, cutoff int) *Node {
+	return difference(T0, D, orNop(tracker), cutoff)
+}
+
+// fork runs the recursive calls of a bulk operation on the left and right of D, the left one on a new goroutine with a forked
+// tracker when D is at least cutoff high, a cutoff of 0 or less never forks
+func fork(D *DictNode, cutoff int, tracker CostTracker, left func(CostTracker) *Node, right func(CostTracker) *Node) (*Node, *Node) {
+	if cutoff <= 0 || D.Height < cutoff {
+		return left(tracker), right(tracker)
+	}
+	forker, ok := tracker.(Forker)
+	if _, nop := tracker.(nopTracker); !ok && !nop {
+		return left(tracker), right(tracker)
+	}
+
+	leftTracker := tracker
+	if ok {
+		leftTracker = forker.Fork()
+	}
+	var L *Node
+	var p interface{}
+	done := make(chan struct{})
+	go func() {
+		// A panic is handed back to the calling goroutine, where it can be recovered
+		defer func() {
+			p = recover()
+			close(done)
+		}()
+		L = left(leftTracker)
+	}()
+	R := right(tracker)
+	<-done
+	if p != nil {
+		panic(p)
+	}
+	if ok {
+		forker.Merge(leftTracker)
+	}
+	return L, R
+}
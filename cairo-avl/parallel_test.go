@@ -0,0 +1,54 @@
+package cairo_avl
+
+import (
+	"bytes"
+	"math/rand"
+	"testing"
+)
+
+func TestParallelOperationsMatchSequential(t *testing.T) {
+	random := rand.New(rand.NewSource(1))
+	input1 := make([]byte, 40000)
+	input2 := make([]byte, 4000)
+	random.Read(input1)
+	random.Read(input2)
+
+	b1 := *(EmbedByteArray(input1))
+	b2 := *(EmbedByteArray(input2))
+	t1 := BuildTreeFromInorder(&b1)
+	D := BuildDictTreeFromInorder(&b2)
+	RootHash(t1, SHA256Hasher, nil)
+
+	operations := []struct {
+		name       string
+		sequential func(*Node, *DictNode, CostTracker) *Node
+		parallel   func(*Node, *DictNode, CostTracker, int) *Node
+	}{
+		{"union", Union, ParallelUnion},
+		{"difference", Difference, ParallelDifference},
+	}
+
+	for _, operation := range operations {
+		session := NewSession()
+		sequential := operation.sequential(t1, D, session)
+		expected := RootHash(sequential, SHA256Hasher, nil)
+
+		for _, cutoff := range []int{1, 3, D.Height + 1} {
+			parallelSession := NewSession()
+			T := operation.parallel(t1, D, parallelSession, cutoff)
+			if !bytes.Equal(RootHash(T, SHA256Hasher, nil), expected) {
+				t.Fatalf("%s with cutoff %v produced a different tree", operation.name, cutoff)
+			}
+			if parallelSession.Stats() != session.Stats() {
+				t.Fatalf("%s with cutoff %v measured %+v, sequentially %+v", operation.name, cutoff, parallelSession.Stats(), session.Stats())
+			}
+			if parallelSession.CountNumberOfNewHashes(T) != session.CountNumberOfNewHashes(sequential) {
+				t.Fatalf("%s with cutoff %v counted a different number of new hashes", operation.name, cutoff)
+			}
+
+			if !bytes.Equal(RootHash(operation.parallel(t1, D, nil, cutoff), SHA256Hasher, nil), expected) {
+				t.Fatalf("%s with cutoff %v and no tracker produced a different tree", operation.name, cutoff)
+			}
+		}
+	}
+}
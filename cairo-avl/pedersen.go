@@ -0,0 +1,233 @@
+package cairo_avl
+
+import (
+	"math/big"
+	"sync"
+)
+
+// The STARK curve is y^2 = x^3 + alpha*x + beta over the STARK field.
+// The constant points come from the StarkWare reference implementation:
+// https://github.com/starkware-libs/cairo-lang/blob/master/src/starkware/crypto/signature/fast_pedersen_hash.py
+var (
+	starkAlpha = feltOne
+
+	pedersenShiftPoint = newAffinePoint(
+		"2089986280348253421170679821480865132823066470938446095505822317253594081284",
+		"1713931329540660377023406109199410414810705867260802078187082345529207694986",
+	)
+	pedersenConstantPoints = [4]*affinePoint{
+		newAffinePoint(
+			"996781205833008774514500082376783249102396023663454813447423147977397232763",
+			"1668503676786377725805489344771023921079126552019160156920634619255970485781",
+		),
+		newAffinePoint(
+			"2251563274489750535117886426533222435294046428347329203627021249169616184184",
+			"1798716007562728905295480679789526322175868328062420237419143593021674992973",
+		),
+		newAffinePoint(
+			"2138414695194151160943305727036575959195309218611738193261179310511854807447",
+			"113410276730064486255102093846540133784865286929052426931474106396135072156",
+		),
+		newAffinePoint(
+			"2379962749567351885752724891227938183011949129833673362440656643086021394946",
+			"776496453633298175483985398648758586525933812536653089401905292063708816422",
+		),
+	}
+)
+
+// pedersenLowBits is the number of bits of an element multiplied by the first point of each pair
+const pedersenLowBits = 248
+
+// pedersenTables holds, for each constant point P and nibble position i, the multiples s * 16^i * P for s in 1..15
+var (
+	pedersenTablesOnce sync.Once
+	pedersenTables     [4][][16]*affinePoint
+)
+
+// affinePoint is a point on the STARK curve in affine coordinates, nil for the point at infinity
+type affinePoint struct {
+	x felt
+	y felt
+}
+
+// jacobianPoint is a point on the STARK curve in jacobian coordinates, z = 0 for the point at infinity
+type jacobianPoint struct {
+	x felt
+	y felt
+	z felt
+}
+
+func newAffinePoint(x string, y string) *affinePoint {
+	px, _ := new(big.Int).SetString(x, 10)
+	py, _ := new(big.Int).SetString(y, 10)
+	return &affinePoint{x: newFelt(px), y: newFelt(py)}
+}
+
+// addAffine adds two affine points, it is only used to build the lookup tables
+func addAffine(p *affinePoint, q *affinePoint) *affinePoint {
+	if p == nil {
+		return q
+	}
+	if q == nil {
+		return p
+	}
+	var lambda felt
+	if p.x == q.x {
+		if p.y.add(q.y).isZero() {
+			return nil
+		}
+		// lambda = (3x^2 + alpha) / 2y
+		x2 := p.x.square()
+		num := x2.add(x2).add(x2).add(starkAlpha)
+		lambda = num.mul(p.y.add(p.y).inverse())
+	} else {
+		// lambda = (y2 - y1) / (x2 - x1)
+		lambda = q.y.sub(p.y).mul(q.x.sub(p.x).inverse())
+	}
+	x := lambda.square().sub(p.x).sub(q.x)
+	y := lambda.mul(p.x.sub(x)).sub(p.y)
+	return &affinePoint{x: x, y: y}
+}
+
+// addMixed adds an affine point to a jacobian point in place
+func (p *jacobianPoint) addMixed(q *affinePoint) {
+	if q == nil {
+		return
+	}
+	if p.z.isZero() {
+		p.x, p.y, p.z = q.x, q.y, feltOne
+		return
+	}
+	z1z1 := p.z.square()
+	u2 := q.x.mul(z1z1)
+	s2 := q.y.mul(p.z).mul(z1z1)
+	h := u2.sub(p.x)
+	r := s2.sub(p.y)
+	if h.isZero() {
+		// Both points share the same x coordinate, fall back to affine arithmetic for the rare edge case
+		sum := addAffine(p.toAffine(), q)
+		if sum == nil {
+			p.z = felt{}
+			return
+		}
+		p.x, p.y, p.z = sum.x, sum.y, feltOne
+		return
+	}
+	hh := h.square()
+	hhh := h.mul(hh)
+	v := p.x.mul(hh)
+
+	// x3 = r^2 - h^3 - 2v, y3 = r(v - x3) - y1 h^3, z3 = z1 h
+	x3 := r.square().sub(hhh).sub(v.add(v))
+	y3 := r.mul(v.sub(x3)).sub(p.y.mul(hhh))
+	p.z = p.z.mul(h)
+	p.x = x3
+	p.y = y3
+}
+
+// toAffine converts a jacobian point back to affine coordinates
+func (p *jacobianPoint) toAffine() *affinePoint {
+	if p.z.isZero() {
+		return nil
+	}
+	zInv := p.z.inverse()
+	zInv2 := zInv.square()
+	return &affinePoint{x: p.x.mul(zInv2), y: p.y.mul(zInv2).mul(zInv)}
+}
+
+// buildPedersenTables precomputes the nibble lookup tables of the four constant points
+func buildPedersenTables() {
+	for i, point := range pedersenConstantPoints {
+		bits := pedersenLowBits
+		if i%2 == 1 {
+			bits = starkPrime.BitLen() - pedersenLowBits
+		}
+		nibbles := (bits + 3) / 4
+		table := make([][16]*affinePoint, nibbles)
+		base := point
+		for n := 0; n < nibbles; n++ {
+			table[n][1] = base
+			for s := 2; s < 16; s++ {
+				table[n][s] = addAffine(table[n][s-1], base)
+			}
+			base = addAffine(table[n][15], base)
+		}
+		pedersenTables[i] = table
+	}
+}
+
+// bitsPerWord is the size in bits of a big.Word on the running platform
+const bitsPerWord = 32 << (^uint(0) >> 63)
+
+// accumulate adds the multiple of the table's point selected by each nibble of k
+func accumulate(acc *jacobianPoint, k *big.Int, table [][16]*affinePoint) {
+	words := k.Bits()
+	for n := range table {
+		bit := n * 4
+		word := bit / bitsPerWord
+		if word >= len(words) {
+			return
+		}
+		nibble := (uint(words[word]) >> uint(bit%bitsPerWord)) & 0xF
+		if nibble != 0 {
+			acc.addMixed(table[n][nibble])
+		}
+	}
+}
+
+// Pedersen computes the StarkNet Pedersen hash of two field elements
+// Both elements must be smaller than the STARK prime
+func Pedersen(a *big.Int, b *big.Int) *big.Int {
+	pedersenTablesOnce.Do(buildPedersenTables)
+
+	lowMask := new(big.Int).Sub(new(big.Int).Lsh(big.NewInt(1), pedersenLowBits), big.NewInt(1))
+	acc := &jacobianPoint{x: pedersenShiftPoint.x, y: pedersenShiftPoint.y, z: feltOne}
+	for i, element := range []*big.Int{a, b} {
+		accumulate(acc, new(big.Int).And(element, lowMask), pedersenTables[2*i])
+		accumulate(acc, new(big.Int).Rsh(element, pedersenLowBits), pedersenTables[2*i+1])
+	}
+	return acc.toAffine().x.big()
+}
+
+// PedersenArray computes the StarkNet array hash h(h(h(h(0, e1), e2), ...), en), n)
+// This is the value returned by compute_hash_on_elements in the Cairo common library
+func PedersenArray(elements ...*big.Int) *big.Int {
+	digest := new(big.Int)
+	for _, element := range elements {
+		digest = Pedersen(digest, element)
+	}
+	return Pedersen(digest, big.NewInt(int64(len(elements))))
+}
+
+// pedersenHasher commits nodes the way a Cairo program would, with compute_hash_on_elements over the node fields and
+// their lengths
+type pedersenHasher struct{}
+
+func (pedersenHasher) Name() string {
+	return "pedersen"
+}
+
+// Check returns ErrNotFelt for an input longer than 32 bytes or not smaller than the STARK prime
+func (pedersenHasher) Check(input []byte) error {
+	return checkFelt(input)
+}
+
+// Hash maps every input to a field element and returns the Pedersen array hash of the elements and their lengths
+// An input that is not a field element panics with ErrNotFelt
+func (pedersenHasher) Hash(inputs ...[]byte) []byte {
+	felts := feltInputs(inputs)
+	elements := make([]*big.Int, len(felts))
+	for i, element := range felts {
+		elements[i] = element.big()
+	}
+	return PedersenArray(elements...).FillBytes(make([]byte, 32))
+}
+
+// PedersenHasher commits nodes with the StarkNet Pedersen hash. A Cairo program computes the same commitment as
+//
+//	compute_hash_on_elements([key, value, height, left, right, nested, lengths])
+//
+// where every field is read as a big endian integer, a missing child or nested tree is 0, and lengths packs the byte
+// lengths of the six fields one per byte, len(key) * 2^40 + len(value) * 2^32 + 8 * 2^24 + len(left) * 2^16 +
+// len(right) * 2^8 + len(nested), with 32 for a commitment and 0 for a missing one
+var PedersenHasher Hasher = pedersenHasher{}
@@ -0,0 +1,142 @@
+package cairo_avl
+
+import (
+	"math/big"
+	"testing"
+)
+
+func feltFromHex(t *testing.T, s string) *big.Int {
+	felt, ok := new(big.Int).SetString(s, 0)
+	if !ok {
+		t.Fatalf("invalid field element %v", s)
+	}
+	return felt
+}
+
+// The vectors below come from the StarkWare reference implementation and the StarkNet documentation
+func TestPedersen(t *testing.T) {
+	tests := []struct {
+		a, b, want string
+	}{
+		{
+			"0x03d937c035c878245caf64531a5756109c53068da139362728feb561405371cb",
+			"0x0208a0a10250e382e1e4bbe2880906c2791bf6275695e02fbbc6aeff9cd8b31a",
+			"0x030e480bed5fe53fa909cc0f8c4d99b8f9f2c016be4c41e13a4848797979c662",
+		},
+		{
+			"0x58f580910a6ca59b28927c08fe6c43e2e303ca384badc365795fc645d479d45",
+			"0x78734f65a067be9bdb39de18434d71e79f7b6466a4b66bbd979ab9e7515fe0b",
+			"0x68cc0b76cddd1dd4ed2301ada9b7c872b23875d5ff837b3a87993e0d9996b87",
+		},
+		{
+			"0x0",
+			"0x0",
+			"0x49ee3eba8c1600700ee1b87eb599f16716b0b1022947733551fde4050ca6804",
+		},
+	}
+	for _, tt := range tests {
+		got := Pedersen(feltFromHex(t, tt.a), feltFromHex(t, tt.b))
+		if got.Cmp(feltFromHex(t, tt.want)) != 0 {
+			t.Fatalf("Pedersen(%v, %v) = %#x, want %v", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
+
+func TestPedersenArray(t *testing.T) {
+	// Contract address of a deployed StarkNet contract, computed as
+	// compute_hash_on_elements([prefix, caller, salt, class_hash, calldata_hash])
+	inputs := []string{
+		"0x535441524b4e45545f434f4e54524143545f41444452455353",
+		"0x0",
+		"0x5bebda1b28ba6daa824126577b9fbc984033e8b18360f5e1ef694cb172c7aa5",
+		"0x0439218681f9108b470d2379cf589ef47e60dc5888ee49ec70071671d74ca9c6",
+		"0x49ee3eba8c1600700ee1b87eb599f16716b0b1022947733551fde4050ca6804",
+	}
+	want := "0x43c6817e70b3fd99a4f120790b2e82c6843df62b573fdadf9e2d677b60ac5eb"
+
+	elements := make([]*big.Int, len(inputs))
+	for i, input := range inputs {
+		elements[i] = feltFromHex(t, input)
+	}
+	if got := PedersenArray(elements...); got.Cmp(feltFromHex(t, want)) != 0 {
+		t.Fatalf("PedersenArray = %#x, want %v", got, want)
+	}
+
+	// A node is committed with compute_hash_on_elements over its fields followed by their byte lengths, so hashing
+	// through the Hasher interface must give the same element
+	fields := [][]byte{elements[0].Bytes(), nil, elements[2].Bytes(), elements[3].Bytes(), elements[4].Bytes()}
+	lengths := new(big.Int).SetBytes([]byte{25, 0, 32, 32, 32})
+	want = PedersenArray(append(elements, lengths)...).Text(16)
+	node := PedersenHasher.Hash(fields...)
+	if new(big.Int).SetBytes(node).Text(16) != want {
+		t.Fatalf("PedersenHasher = %x, want %v", node, want)
+	}
+}
+
+// childLength is the byte length a child commitment is hashed with, zero for a missing child
+func childLength(hash *big.Int) byte {
+	if hash.Sign() == 0 {
+		return 0
+	}
+	return 32
+}
+
+// The vector below holds the seven elements a Cairo program hashes for a node with key 0x01020304, value 0x0506,
+// height 1 and the commitments of its children and nested tree, with their Pedersen and Poseidon hashes
+var nodeVector = struct {
+	key, value          []byte
+	left, right, nested string
+	lengths             string
+	pedersen, poseidon  string
+}{
+	key:      []byte{1, 2, 3, 4},
+	value:    []byte{5, 6},
+	left:     "0x3d937c035c878245caf64531a5756109c53068da139362728feb561405371cb",
+	right:    "0x208a0a10250e382e1e4bbe2880906c2791bf6275695e02fbbc6aeff9cd8b31a",
+	nested:   "0x30e480bed5fe53fa909cc0f8c4d99b8f9f2c016be4c41e13a4848797979c662",
+	lengths:  "0x40208202020",
+	pedersen: "0x7c5648d07d6e9addefb2926c81b31eda6c15380a9eca2feceec9fffea871525",
+	poseidon: "0x6015da1e91c7e11e07e3ef4f2ae2d89217a772875fa0cba28a917c8a7b7b602",
+}
+
+// nodeVectorElements returns the elements of the node vector and the node hash of its fields through a hasher
+func nodeVectorElements(t *testing.T, hasher Hasher) ([]*big.Int, *big.Int) {
+	left, right, nested := feltFromHex(t, nodeVector.left), feltFromHex(t, nodeVector.right), feltFromHex(t, nodeVector.nested)
+	elements := []*big.Int{
+		big.NewInt(0x01020304), big.NewInt(0x0506), big.NewInt(1), left, right, nested, feltFromHex(t, nodeVector.lengths),
+	}
+	commitment := func(x *big.Int) []byte {
+		return x.FillBytes(make([]byte, 32))
+	}
+	hash := hashNode(hasher, nodeVector.key, nodeVector.value, 1, commitment(left), commitment(right), commitment(nested))
+	return elements, new(big.Int).SetBytes(hash)
+}
+
+func TestPedersenNodeVector(t *testing.T) {
+	elements, got := nodeVectorElements(t, PedersenHasher)
+	want := feltFromHex(t, nodeVector.pedersen)
+	if PedersenArray(elements...).Cmp(want) != 0 {
+		t.Fatalf("compute_hash_on_elements = %#x, want %v", PedersenArray(elements...), nodeVector.pedersen)
+	}
+	if got.Cmp(want) != 0 {
+		t.Fatalf("PedersenHasher node hash = %#x, want %v", got, nodeVector.pedersen)
+	}
+}
+
+func TestPedersenRootHash(t *testing.T) {
+	b := *(EmbedByteArray([]byte{0, 0, 0, 1, 0, 0, 0, 2, 0, 0, 0, 3}))
+	t1 := BuildTreeFromInorder(&b)
+
+	// Commit the three node tree by hand, the way a Cairo program would with compute_hash_on_elements
+	commit := func(n *Node, left, right *big.Int) *big.Int {
+		lengths := new(big.Int).SetBytes([]byte{byte(len(n.Key)), byte(len(n.Value)), 8, childLength(left), childLength(right), 0})
+		return PedersenArray(toFelt(n.Key).big(), toFelt(n.Value).big(), big.NewInt(int64(n.Height)), left, right, new(big.Int), lengths)
+	}
+	left := commit(t1.Left, new(big.Int), new(big.Int))
+	right := commit(t1.Right, new(big.Int), new(big.Int))
+	want := commit(t1, left, right)
+
+	if got := new(big.Int).SetBytes(RootHash(t1, PedersenHasher, nil)); got.Cmp(want) != 0 {
+		t.Fatalf("RootHash = %#x, want %#x", got, want)
+	}
+}
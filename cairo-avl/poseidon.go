@@ -0,0 +1,117 @@
+package cairo_avl
+
+import (
+	"math/big"
+	"sync"
+)
+
+// The StarkNet Poseidon hash is the Hades permutation over the STARK field with a state of three elements,
+// a rate of two, the S-box x^3, 8 full rounds split around 83 partial rounds and the MDS matrix
+// ((3, 1, 1), (1, -1, 1), (1, 1, -2))
+const (
+	poseidonFullRounds    = 8
+	poseidonPartialRounds = 83
+)
+
+var (
+	poseidonKeysOnce sync.Once
+	poseidonKeys     [poseidonFullRounds + poseidonPartialRounds][3]felt
+)
+
+// loadPoseidonRoundKeys parses the round constants once
+func loadPoseidonRoundKeys() {
+	for r, round := range poseidonRoundKeys {
+		for i, key := range round {
+			k, _ := new(big.Int).SetString(key, 10)
+			poseidonKeys[r][i] = newFelt(k)
+		}
+	}
+}
+
+// mix multiplies the state by the MDS matrix
+func mix(state *[3]felt) {
+	sum := state[0].add(state[1]).add(state[2])
+	state[0] = sum.add(state[0].add(state[0]))
+	state[1] = sum.sub(state[1].add(state[1]))
+	state[2] = sum.sub(state[2].add(state[2]).add(state[2]))
+}
+
+// hadesPermutation applies the Hades permutation to the state in place
+func hadesPermutation(state *[3]felt) {
+	poseidonKeysOnce.Do(loadPoseidonRoundKeys)
+
+	totalRounds := poseidonFullRounds + poseidonPartialRounds
+	for r := 0; r < totalRounds; r++ {
+		for i := range state {
+			state[i] = state[i].add(poseidonKeys[r][i])
+		}
+		if r < poseidonFullRounds/2 || r >= totalRounds-poseidonFullRounds/2 {
+			state[0] = state[0].square().mul(state[0])
+			state[1] = state[1].square().mul(state[1])
+		}
+		state[2] = state[2].square().mul(state[2])
+		mix(state)
+	}
+}
+
+// Poseidon computes the StarkNet Poseidon hash of two field elements
+func Poseidon(x *big.Int, y *big.Int) *big.Int {
+	state := [3]felt{newFelt(x), newFelt(y), newFelt(big.NewInt(2))}
+	hadesPermutation(&state)
+	return state[0].big()
+}
+
+// PoseidonArray computes the StarkNet sponge hash of a list of field elements
+// This is the value returned by poseidon_hash_many in the Cairo common library, the input is padded with 1
+// when its length is odd and with 1, 0 otherwise
+func PoseidonArray(elements ...*big.Int) *big.Int {
+	felts := make([]felt, len(elements))
+	for i, element := range elements {
+		felts[i] = newFelt(element)
+	}
+	return poseidonMany(felts).big()
+}
+
+// poseidonMany is the sponge behind PoseidonArray, working on field elements directly
+func poseidonMany(elements []felt) felt {
+	var state [3]felt
+	for i := 0; i+1 < len(elements); i += 2 {
+		state[0] = state[0].add(elements[i])
+		state[1] = state[1].add(elements[i+1])
+		hadesPermutation(&state)
+	}
+
+	rem := len(elements) % 2
+	if rem == 1 {
+		state[0] = state[0].add(elements[len(elements)-1])
+	}
+	state[rem] = state[rem].add(feltOne)
+	hadesPermutation(&state)
+	return state[0]
+}
+
+// poseidonHasher commits nodes the way a Cairo program would, with poseidon_hash_many over the node fields and their
+// lengths
+type poseidonHasher struct{}
+
+func (poseidonHasher) Name() string {
+	return "poseidon"
+}
+
+// Check returns ErrNotFelt for an input longer than 32 bytes or not smaller than the STARK prime
+func (poseidonHasher) Check(input []byte) error {
+	return checkFelt(input)
+}
+
+// Hash maps every input to a field element and returns the Poseidon sponge hash of the elements and their lengths
+// An input that is not a field element panics with ErrNotFelt
+func (poseidonHasher) Hash(inputs ...[]byte) []byte {
+	return poseidonMany(feltInputs(inputs)).bytes()
+}
+
+// PoseidonHasher commits nodes with the StarkNet Poseidon hash. A Cairo program computes the same commitment as
+//
+//	poseidon_hash_many([key, value, height, left, right, nested, lengths])
+//
+// over the same seven elements as PedersenHasher
+var PoseidonHasher Hasher = poseidonHasher{}
@@ -0,0 +1,63 @@
+package cairo_avl
+
+import (
+	"math/big"
+	"testing"
+)
+
+// The vectors below come from the StarkNet documentation and the cairo-lang test suite
+func TestPoseidon(t *testing.T) {
+	want := "0x5d44a3decb2b2e0cc71071f7b802f45dd792d064f0fc7316c46514f70f9891a"
+	if got := Poseidon(big.NewInt(1), big.NewInt(2)); got.Cmp(feltFromHex(t, want)) != 0 {
+		t.Fatalf("Poseidon(1, 2) = %#x, want %v", got, want)
+	}
+}
+
+func TestPoseidonArray(t *testing.T) {
+	tests := []struct {
+		elements []int64
+		want     string
+	}{
+		{[]int64{}, "0x2272be0f580fd156823304800919530eaa97430e972d7213ee13f4fbf7a5dbc"},
+		{[]int64{0, 1, 2}, "0x7a01142da8aecae3782ba66fc3285fd02fcd2c55aa868fe50fd95c089068d16"},
+		{[]int64{0, 1, 2, 3}, "0x7b8f30ac298ea12d170c0873f1fa631a18c00756c6e7d1fd273b9a239d0d413"},
+	}
+	for _, tt := range tests {
+		elements := make([]*big.Int, len(tt.elements))
+		for i, e := range tt.elements {
+			elements[i] = big.NewInt(e)
+		}
+		if got := PoseidonArray(elements...); got.Cmp(feltFromHex(t, tt.want)) != 0 {
+			t.Fatalf("PoseidonArray(%v) = %#x, want %v", tt.elements, got, tt.want)
+		}
+	}
+}
+
+func TestPoseidonNodeVector(t *testing.T) {
+	elements, got := nodeVectorElements(t, PoseidonHasher)
+	want := feltFromHex(t, nodeVector.poseidon)
+	if PoseidonArray(elements...).Cmp(want) != 0 {
+		t.Fatalf("poseidon_hash_many = %#x, want %v", PoseidonArray(elements...), nodeVector.poseidon)
+	}
+	if got.Cmp(want) != 0 {
+		t.Fatalf("PoseidonHasher node hash = %#x, want %v", got, nodeVector.poseidon)
+	}
+}
+
+func TestPoseidonRootHash(t *testing.T) {
+	b := *(EmbedByteArray([]byte{0, 0, 0, 1, 0, 0, 0, 2, 0, 0, 0, 3}))
+	t1 := BuildTreeFromInorder(&b)
+
+	// Commit the three node tree by hand, the way a Cairo program would with poseidon_hash_many
+	commit := func(n *Node, left, right *big.Int) *big.Int {
+		lengths := new(big.Int).SetBytes([]byte{byte(len(n.Key)), byte(len(n.Value)), 8, childLength(left), childLength(right), 0})
+		return PoseidonArray(toFelt(n.Key).big(), toFelt(n.Value).big(), big.NewInt(int64(n.Height)), left, right, new(big.Int), lengths)
+	}
+	left := commit(t1.Left, new(big.Int), new(big.Int))
+	right := commit(t1.Right, new(big.Int), new(big.Int))
+	want := commit(t1, left, right)
+
+	if got := new(big.Int).SetBytes(RootHash(t1, PoseidonHasher, nil)); got.Cmp(want) != 0 {
+		t.Fatalf("RootHash = %#x, want %#x", got, want)
+	}
+}
@@ -0,0 +1,119 @@
+package cairo_avl
+
+import (
+	"bytes"
+	"errors"
+)
+
+// ErrInvalidProof is returned when a proof does not match the root hash it is checked against
+var ErrInvalidProof = errors.New("invalid proof")
+
+// ProofStep is a node on the search path of a key, along with the commitments of its children and nested tree
+type ProofStep struct {
+	Key    []byte
+	Value  []byte
+	Height int
+	Left   []byte
+	Right  []byte
+	Nested []byte
+}
+
+// Proof is the search path of a key, starting from the root
+// When the key is absent the path ends at the node whose child the key would be, and its in-order
+// neighbours are the last steps of the path where the descent went right and left respectively
+type Proof struct {
+	Steps []ProofStep
+}
+
+// hash returns the commitment of the node described by a step
+func (s *ProofStep) hash(hasher Hasher) []byte {
+	return hashNode(hasher, s.Key, s.Value, s.Height, s.Left, s.Right, s.Nested)
+}
+
+// Prove collects the search path of a key, following the same descent as IsInTree
+// Commitments missing from the tree are computed with the hasher and cached on the nodes
+func Prove(root *Node, key []byte, hasher Hasher) *Proof {
+	proof := &Proof{}
+	for root != nil {
+		proof.Steps = append(proof.Steps, ProofStep{
+			Key:    root.Key,
+			Value:  root.Value,
+			Height: root.Height,
+			Left:   RootHash(root.Left, hasher, nil),
+			Right:  RootHash(root.Right, hasher, nil),
+			Nested: RootHash(root.Nested, hasher, nil),
+		})
+		cmp := bytes.Compare(key, root.Key)
+		if cmp == 0 {
+			break
+		}
+		if cmp == -1 {
+			root = root.Left
+		} else {
+			root = root.Right
+		}
+	}
+	return proof
+}
+
+// Verify checks a proof against a root hash and reports whether the key is in the tree
+// The value of a member key is the Value of the last step of the proof
+// A proof with an input the hasher rejects fails with ErrNotFelt
+func Verify(rootHash []byte, key []byte, proof *Proof, hasher Hasher) (found bool, err error) {
+	defer recoverNotFelt(&err)
+	if len(proof.Steps) == 0 {
+		if len(rootHash) != 0 {
+			return false, ErrInvalidProof
+		}
+		return false, nil
+	}
+
+	// Walk down the path, checking that every step is the child the descent of the key leads to
+	for i := range proof.Steps {
+		step := &proof.Steps[i]
+		cmp := bytes.Compare(key, step.Key)
+		last := i == len(proof.Steps)-1
+		if cmp == 0 {
+			if !last {
+				return false, ErrInvalidProof
+			}
+			found = true
+			break
+		}
+
+		child := step.Right
+		if cmp == -1 {
+			child = step.Left
+		}
+		if last {
+			// The key is absent only if the descent falls off the tree
+			if len(child) != 0 {
+				return false, ErrInvalidProof
+			}
+			break
+		}
+		if !bytes.Equal(child, proof.Steps[i+1].hash(hasher)) {
+			return false, ErrInvalidProof
+		}
+	}
+
+	if !bytes.Equal(rootHash, proof.Steps[0].hash(hasher)) {
+		return false, ErrInvalidProof
+	}
+	return found, nil
+}
+
+// Neighbours returns the steps holding the in-order predecessor and successor of a key, nil when there is none
+// For a verified non-membership proof they are the two adjacent keys of the tree between which the key would sit
+func (p *Proof) Neighbours(key []byte) (predecessor *ProofStep, successor *ProofStep) {
+	for i := range p.Steps {
+		step := &p.Steps[i]
+		cmp := bytes.Compare(key, step.Key)
+		if cmp == -1 {
+			successor = step
+		} else if cmp == 1 {
+			predecessor = step
+		}
+	}
+	return predecessor, successor
+}
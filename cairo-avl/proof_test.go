@@ -0,0 +1,93 @@
+package cairo_avl
+
+import (
+	"bytes"
+	"testing"
+)
+
+func FuzzProve(f *testing.F) {
+	f.Add([]byte{1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15, 16}, []byte{5, 6, 7, 8, 1, 1, 1, 1})
+
+	f.Fuzz(func(t *testing.T, input1 []byte, input2 []byte) {
+		b1 := *(EmbedByteArray(input1))
+		b2 := *(EmbedByteArray(input2))
+
+		t1 := BuildTreeFromInorder(&b1)
+		rootHash := RootHash(t1, SHA256Hasher, nil)
+
+		// Every key of the tree has a membership proof carrying its value
+		for _, key := range *(GetInorderTraversal(t1)) {
+			proof := Prove(t1, key, SHA256Hasher)
+			found, err := Verify(rootHash, key, proof, SHA256Hasher)
+			if err != nil || !found {
+				t.Fatalf("Key: %v in t1 failed to verify: %v", key, err)
+			}
+			if value := proof.Steps[len(proof.Steps)-1].Value; !bytes.Equal(value, key) {
+				t.Fatalf("Key: %v proved with value %v", key, value)
+			}
+		}
+
+		// Every other key has a non-membership proof whose neighbours enclose it
+		for _, key := range b2 {
+			if IsInTree(t1, &key) {
+				continue
+			}
+			proof := Prove(t1, key, SHA256Hasher)
+			found, err := Verify(rootHash, key, proof, SHA256Hasher)
+			if err != nil || found {
+				t.Fatalf("Key: %v not in t1 failed to verify: %v", key, err)
+			}
+			predecessor, successor := proof.Neighbours(key)
+			for _, other := range *(GetInorderTraversal(t1)) {
+				if predecessor != nil && bytes.Compare(predecessor.Key, other) == -1 && bytes.Compare(other, key) == -1 {
+					t.Fatalf("Key: %v lies between %v and %v", other, predecessor.Key, key)
+				}
+				if successor != nil && bytes.Compare(key, other) == -1 && bytes.Compare(other, successor.Key) == -1 {
+					t.Fatalf("Key: %v lies between %v and %v", other, key, successor.Key)
+				}
+			}
+		}
+	})
+}
+
+func TestVerifyRejectsTamperedProofs(t *testing.T) {
+	b := *(EmbedByteArray([]byte{1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15, 16, 17, 18, 19, 20}))
+	t1 := BuildTreeFromInorder(&b)
+	rootHash := RootHash(t1, SHA256Hasher, nil)
+	key := b[0]
+
+	proof := Prove(t1, key, SHA256Hasher)
+	proof.Steps[len(proof.Steps)-1].Value = []byte{0}
+	if _, err := Verify(rootHash, key, proof, SHA256Hasher); err != ErrInvalidProof {
+		t.Fatalf("proof with a forged value verified")
+	}
+
+	// A membership proof cut short does not prove absence
+	proof = Prove(t1, key, SHA256Hasher)
+	proof.Steps = proof.Steps[:len(proof.Steps)-1]
+	if _, err := Verify(rootHash, key, proof, SHA256Hasher); err != ErrInvalidProof {
+		t.Fatalf("truncated proof verified")
+	}
+}
+
+func TestVerifyRejectsCollidingFelts(t *testing.T) {
+	for _, hasher := range []Hasher{PedersenHasher, PoseidonHasher} {
+		t1 := &Node{Key: []byte{2}, Value: []byte{7}, Height: 1}
+		rootHash := RootHash(t1, hasher, nil)
+
+		// {0, 0, 2} and {2} are the same field element, only their lengths tell them apart
+		key := []byte{0, 0, 2}
+		proof := Prove(t1, []byte{2}, hasher)
+		proof.Steps[0].Key = key
+		if _, err := Verify(rootHash, key, proof, hasher); err != ErrInvalidProof {
+			t.Fatalf("proof for a colliding key verified: %v", err)
+		}
+
+		// Inputs are rejected rather than reduced modulo the prime
+		proof = Prove(t1, []byte{2}, hasher)
+		proof.Steps[0].Value = starkPrime.Bytes()
+		if _, err := Verify(rootHash, []byte{2}, proof, hasher); err != ErrNotFelt {
+			t.Fatalf("proof with a value outside the field = %v, want %v", err, ErrNotFelt)
+		}
+	}
+}
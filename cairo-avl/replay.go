@@ -0,0 +1,91 @@
+package cairo_avl
+
+import (
+	"bytes"
+	"errors"
+)
+
+var (
+	// ErrMissingWitnessNode is returned when a replayed operation needs a node the witness does not hold
+	ErrMissingWitnessNode = errors.New("node missing from witness")
+	// ErrOldRootMismatch is returned when the witness does not commit to the expected old root
+	ErrOldRootMismatch = errors.New("witness does not match the old root")
+	// ErrNewRootMismatch is returned when the replayed operation does not produce the claimed new root
+	ErrNewRootMismatch = errors.New("replayed operation does not match the new root")
+)
+
+// VerifyUnion replays Union(T0, D) over the nodes of a witness and confirms the new root it claims
+// Only exposed nodes are opened; nodes whose height was only taken have their height checked against their
+// commitment, recomputed from the fields the witness holds, and every other subtree is known by its commitment alone
+func VerifyUnion(oldRoot []byte, D *DictNode, w *Witness, hasher Hasher) ([]byte, error) {
+	return replay(oldRoot, D, w, hasher, Union)
+}
+
+// VerifyDifference replays Difference(T0, D) over the nodes of a witness and confirms the new root it claims
+func VerifyDifference(oldRoot []byte, D *DictNode, w *Witness, hasher Hasher) ([]byte, error) {
+	return replay(oldRoot, D, w, hasher, Difference)
+}
+
+// VerifyIntersection replays Intersection(T0, D) over the nodes of a witness and confirms the new root it claims
+func VerifyIntersection(oldRoot []byte, D *DictNode, w *Witness, hasher Hasher) ([]byte, error) {
+	return replay(oldRoot, D, w, hasher, Intersection)
+}
+
+// VerifySymmetricDifference replays SymmetricDifference(T0, D) over the nodes of a witness and confirms the new root it claims
+func VerifySymmetricDifference(oldRoot []byte, D *DictNode, w *Witness, hasher Hasher) ([]byte, error) {
+	return replay(oldRoot, D, w, hasher, SymmetricDifference)
+}
+
+// VerifyApply replays Apply(T0, D) over the nodes of a witness and confirms the new root it claims
+func VerifyApply(oldRoot []byte, D *DictNode, w *Witness, hasher Hasher) ([]byte, error) {
+	return replay(oldRoot, D, w, hasher, Apply)
+}
+
+func replay(oldRoot []byte, D *DictNode, w *Witness, hasher Hasher, operation func(*Node, *DictNode, CostTracker) *Node) (newRoot []byte, err error) {
+	defer recoverNotFelt(&err)
+	next := 0
+	T0 := rebuildFromWitness(oldRoot, len(w.Nodes) > 0, w, hasher, &next)
+	if !bytes.Equal(w.OldRoot, oldRoot) || !bytes.Equal(RootHash(T0, hasher, nil), oldRoot) {
+		return nil, ErrOldRootMismatch
+	}
+
+	defer func() {
+		if r := recover(); r != nil {
+			if r != ErrMissingWitnessNode {
+				panic(r)
+			}
+			newRoot, err = nil, ErrMissingWitnessNode
+		}
+	}()
+
+	T := operation(T0, D, nil)
+	newRoot = RootHash(T, hasher, nil)
+	if !bytes.Equal(newRoot, w.NewRoot) {
+		return nil, ErrNewRootMismatch
+	}
+	return newRoot, nil
+}
+
+// rebuildFromWitness rebuilds the subtree committed to by hash, consuming the witness nodes in the pre-order they were collected in
+// A subtree whose witness node does not follow is pruned to its commitment; every other node gets its commitment
+// recomputed so that the root hash of the rebuilt tree checks the whole witness, the heights of the nodes left pruned included
+func rebuildFromWitness(hash []byte, follows bool, w *Witness, hasher Hasher, next *int) *Node {
+	if len(hash) == 0 {
+		return nil
+	}
+	if !follows || *next >= len(w.Nodes) {
+		return &Node{commitments: []commitment{{hasher, hash}}, pruned: true}
+	}
+	entry := &w.Nodes[*next]
+	*next++
+
+	if !entry.Exposed {
+		hash = hashNode(hasher, entry.Key, entry.Value, entry.Height, entry.Left, entry.Right, entry.Nested)
+		return &Node{Height: entry.Height, commitments: []commitment{{hasher, hash}}, pruned: true, heightKnown: true}
+	}
+	node := &Node{Key: entry.Key, Value: entry.Value, Height: entry.Height}
+	node.Left = rebuildFromWitness(entry.Left, entry.LeftFollows, w, hasher, next)
+	node.Right = rebuildFromWitness(entry.Right, entry.RightFollows, w, hasher, next)
+	node.Nested = rebuildFromWitness(entry.Nested, entry.NestedFollows, w, hasher, next)
+	return node
+}
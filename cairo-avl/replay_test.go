@@ -0,0 +1,193 @@
+package cairo_avl
+
+import (
+	"bytes"
+	"testing"
+)
+
+func FuzzVerifyUnion(f *testing.F) {
+	f.Add([]byte{1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15, 16, 17, 18, 19, 20}, []byte{5, 6, 7, 8, 1, 1, 1, 1, 13, 14, 15, 16})
+
+	f.Fuzz(func(t *testing.T, input1 []byte, input2 []byte) {
+		operations := []struct {
+			run    func(*Node, *DictNode, CostTracker) *Node
+			verify func([]byte, *DictNode, *Witness, Hasher) ([]byte, error)
+		}{
+			{Union, VerifyUnion},
+			{Difference, VerifyDifference},
+			{Intersection, VerifyIntersection},
+			{SymmetricDifference, VerifySymmetricDifference},
+			{Apply, VerifyApply},
+		}
+
+		for _, operation := range operations {
+			b1 := *(EmbedByteArray(input1))
+			b2 := *(EmbedByteArray(input2))
+
+			t1 := BuildTreeFromInorder(&b1)
+			D := BuildDictTreeFromInorder(&b2)
+			oldRoot := RootHash(t1, SHA256Hasher, nil)
+
+			session := NewSession()
+			T := operation.run(t1, D, session)
+			w, err := DecodeWitness(BuildWitness(t1, T, session, SHA256Hasher).Encode())
+			if err != nil {
+				t.Fatalf("could not decode the witness: %v", err)
+			}
+
+			newRoot, err := operation.verify(oldRoot, D, w, SHA256Hasher)
+			if err != nil {
+				t.Fatalf("replay failed: %v", err)
+			}
+			if !bytes.Equal(newRoot, RootHash(T, SHA256Hasher, nil)) {
+				t.Fatalf("replay confirmed %x, the operation produced %x", newRoot, RootHash(T, SHA256Hasher, nil))
+			}
+
+			// Pruning any exposed node makes the replay fail instead of producing a wrong root
+			for i, node := range w.Nodes {
+				if !node.Exposed {
+					continue
+				}
+				partial := pruneWitness(w, i)
+				if _, err := operation.verify(oldRoot, D, partial, SHA256Hasher); err != ErrMissingWitnessNode {
+					t.Fatalf("replay without the node of key %v returned %v", node.Key, err)
+				}
+			}
+		}
+	})
+}
+
+// pruneWitness returns a copy of the witness with the node at index i pruned to its commitment along with its subtree
+func pruneWitness(w *Witness, i int) *Witness {
+	nodes := append([]WitnessNode(nil), w.Nodes...)
+	pruned := len(nodes)
+	// walk returns the index following the subtree of the node at index j
+	var walk func(j int) int
+	walk = func(j int) int {
+		next := j + 1
+		if !nodes[j].Exposed {
+			return next
+		}
+		for _, follows := range []*bool{&nodes[j].LeftFollows, &nodes[j].RightFollows, &nodes[j].NestedFollows} {
+			if !*follows {
+				continue
+			}
+			child := next
+			next = walk(child)
+			if child == i {
+				*follows = false
+				pruned = next
+			}
+		}
+		return next
+	}
+	if i == 0 {
+		return &Witness{OldRoot: w.OldRoot, NewRoot: w.NewRoot}
+	}
+	walk(0)
+	return &Witness{OldRoot: w.OldRoot, NewRoot: w.NewRoot, Nodes: append(nodes[:i:i], nodes[pruned:]...)}
+}
+
+func TestVerifyUnionWithDuplicateNestedTrees(t *testing.T) {
+	b := [][]byte{{1}, {2}, {3}}
+	t1 := BuildTreeFromInorder(&b)
+	nested := [][]byte{{10}, {11}, {12}}
+	t1.Nested = BuildTreeFromInorder(&nested)
+	t1.Right.Nested = BuildTreeFromInorder(&nested)
+	oldRoot := RootHash(t1, SHA256Hasher, nil)
+
+	// The nested tree of key 3 is left pruned with the same commitment as the nested tree opened for key 2
+	batch := NewBatchBuilder()
+	batch.NestedPut([]byte{2}, []byte{13}, []byte{13})
+	batch.Put([]byte{3}, []byte{30})
+	D := batch.Build()
+
+	session := NewSession()
+	tU := Union(t1, D, session)
+	w := BuildWitness(t1, tU, session, SHA256Hasher)
+	newRoot, err := VerifyUnion(oldRoot, D, w, SHA256Hasher)
+	if err != nil {
+		t.Fatalf("replay failed: %v", err)
+	}
+	if !bytes.Equal(newRoot, RootHash(tU, SHA256Hasher, nil)) {
+		t.Fatalf("replay confirmed %x, the union produced %x", newRoot, RootHash(tU, SHA256Hasher, nil))
+	}
+}
+
+func TestVerifyUnionRejectsForgedHeights(t *testing.T) {
+	// Inserting below the leftmost key takes the height of the right subtree without exposing it
+	b1 := *(EmbedByteArray([]byte{0, 0, 0, 2, 0, 0, 0, 4, 0, 0, 0, 6}))
+	b2 := *(EmbedByteArray([]byte{0, 0, 0, 1}))
+
+	t1 := BuildTreeFromInorder(&b1)
+	D := BuildDictTreeFromInorder(&b2)
+	oldRoot := RootHash(t1, SHA256Hasher, nil)
+
+	session := NewSession()
+	w := BuildWitness(t1, Union(t1, D, session), session, SHA256Hasher)
+
+	forged := 0
+	for i := range w.Nodes {
+		if w.Nodes[i].Exposed {
+			continue
+		}
+		w.Nodes[i].Height++
+		if _, err := VerifyUnion(oldRoot, D, w, SHA256Hasher); err != ErrOldRootMismatch {
+			t.Fatalf("replay with a forged height for key %v returned %v", w.Nodes[i].Key, err)
+		}
+		w.Nodes[i].Height--
+		forged++
+	}
+	if forged == 0 {
+		t.Fatalf("witness holds no height taken node")
+	}
+}
+
+func TestVerifyUnionRejectsWrongRoots(t *testing.T) {
+	b1 := *(EmbedByteArray([]byte{1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15, 16, 17, 18, 19, 20}))
+	b2 := *(EmbedByteArray([]byte{5, 6, 7, 8, 1, 1, 1, 1}))
+
+	t1 := BuildTreeFromInorder(&b1)
+	D := BuildDictTreeFromInorder(&b2)
+	oldRoot := RootHash(t1, SHA256Hasher, nil)
+
+	session := NewSession()
+	w := BuildWitness(t1, Union(t1, D, session), session, SHA256Hasher)
+
+	if _, err := VerifyUnion(SHA256Hasher.Hash([]byte{0}), D, w, SHA256Hasher); err != ErrOldRootMismatch {
+		t.Fatalf("replay against the wrong old root returned %v", err)
+	}
+
+	w.NewRoot = oldRoot
+	if _, err := VerifyUnion(oldRoot, D, w, SHA256Hasher); err != ErrNewRootMismatch {
+		t.Fatalf("replay against the wrong new root returned %v", err)
+	}
+}
+
+func TestVerifyRejectsNonFeltKeys(t *testing.T) {
+	b1 := *(EmbedByteArray([]byte{0, 0, 0, 5}))
+	b2 := *(EmbedByteArray([]byte{0, 0, 0, 6}))
+	t1 := BuildTreeFromInorder(&b1)
+
+	// A key over 32 bytes is no field element
+	key := bytes.Repeat([]byte{0xff}, 40)
+	batch := NewBatchBuilder()
+	batch.Put(key, key)
+	forged := batch.Build()
+
+	verifiers := []func([]byte, *DictNode, *Witness, Hasher) ([]byte, error){VerifyUnion, VerifyDifference, VerifyApply}
+	for _, hasher := range []Hasher{PedersenHasher, PoseidonHasher} {
+		oldRoot := RootHash(t1, hasher, nil)
+		session := NewSession()
+		w := BuildWitness(t1, Union(t1, BuildDictTreeFromInorder(&b2), session), session, hasher)
+
+		for _, verify := range verifiers {
+			if _, err := verify(oldRoot, forged, w, hasher); err == nil {
+				t.Fatalf("%s replay with a %v byte key succeeded", hasher.Name(), len(key))
+			}
+		}
+		if _, err := VerifyUnion(oldRoot, forged, w, hasher); err != ErrNotFelt {
+			t.Fatalf("%s union with a %v byte key returned %v", hasher.Name(), len(key), err)
+		}
+	}
+}
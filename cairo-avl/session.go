@@ -0,0 +1,248 @@
+package cairo_avl
+
+// Session is the default CostTracker, it keeps the measurement state of one operation keyed by node identity
+// The measured tree is never written to, so any number of sessions can measure operations on the same tree,
+// one after another or concurrently, a single session must not be shared between goroutines
+// Events on nested trees are recorded through the tracker returned by Nest and attributed to their nesting level
+type Session struct {
+	exposed     map[*Node]int
+	heightTaken map[*Node]int
+	created     map[*Node]int
+	levels      []Stats
+	forks       []*Session
+}
+
+// NewSession is a custom constructor method to initialise an empty Session
+func NewSession() *Session {
+	return &Session{
+		exposed:     make(map[*Node]int),
+		heightTaken: make(map[*Node]int),
+		created:     make(map[*Node]int),
+	}
+}
+
+// Stats returns the events recorded so far on every nesting level
+func (s *Session) Stats() Stats {
+	s.flatten()
+	var total Stats
+	for _, level := range s.levels {
+		total.add(level)
+	}
+	return total
+}
+
+// LevelStats returns the events recorded so far on each nesting level, the outermost tree being level 0
+func (s *Session) LevelStats() []Stats {
+	s.flatten()
+	return append([]Stats{}, s.levels...)
+}
+
+// Exposed reports whether the session opened a pre-existing node
+func (s *Session) Exposed(node *Node) bool {
+	s.flatten()
+	_, ok := s.exposed[node]
+	return ok
+}
+
+// HeightTaken reports whether the session read the height of a pre-existing node without opening it
+func (s *Session) HeightTaken(node *Node) bool {
+	s.flatten()
+	_, ok := s.heightTaken[node]
+	return ok
+}
+
+// Created reports whether the node was created during the session
+func (s *Session) Created(node *Node) bool {
+	s.flatten()
+	_, ok := s.created[node]
+	return ok
+}
+
+// at returns the stats of a nesting level, adding the levels missing so far
+func (s *Session) at(level int) *Stats {
+	for len(s.levels) <= level {
+		s.levels = append(s.levels, Stats{})
+	}
+	return &s.levels[level]
+}
+
+func (s *Session) Expose(node *Node) {
+	s.expose(node, 0)
+}
+
+func (s *Session) HeightRead(node *Node) {
+	s.heightRead(node, 0)
+}
+
+func (s *Session) NodeCreated(node *Node) {
+	s.nodeCreated(node, 0)
+}
+
+func (s *Session) Rotation() {
+	s.at(0).Rotations++
+}
+
+func (s *Session) Split() {
+	s.at(0).Splits++
+}
+
+func (s *Session) Join() {
+	s.at(0).Joins++
+}
+
+func (s *Session) Hashed(*Node) {
+	s.at(0).Hashes++
+}
+
+// Nest returns the tracker recording the events on the nested trees of the session's tree
+func (s *Session) Nest() CostTracker {
+	return &levelTracker{session: s, level: 1}
+}
+
+// expose counts a pre-existing node the first time it is opened, a node whose height was taken before is only counted as exposed
+func (s *Session) expose(node *Node, level int) {
+	if _, ok := s.created[node]; ok {
+		return
+	}
+	if _, ok := s.exposed[node]; ok {
+		return
+	}
+	if l, ok := s.heightTaken[node]; ok {
+		delete(s.heightTaken, node)
+		s.at(l).HeightTakenNodes--
+	}
+	s.exposed[node] = level
+	s.at(level).ExposedNodes++
+}
+
+// heightRead counts a pre-existing node the first time its height is read, unless it was opened before
+func (s *Session) heightRead(node *Node, level int) {
+	if _, ok := s.created[node]; ok {
+		return
+	}
+	if _, ok := s.exposed[node]; ok {
+		return
+	}
+	if _, ok := s.heightTaken[node]; ok {
+		return
+	}
+	s.heightTaken[node] = level
+	s.at(level).HeightTakenNodes++
+}
+
+func (s *Session) nodeCreated(node *Node, level int) {
+	s.created[node] = level
+	s.at(level).CreatedNodes++
+}
+
+// CountNumberOfNewHashes counts the nodes of a tree, nested trees included, that were created during the session
+func (s *Session) CountNumberOfNewHashes(root *Node) int {
+	if root == nil {
+		return 0
+	}
+	s.flatten()
+	count := s.CountNumberOfNewHashes(root.Left) + s.CountNumberOfNewHashes(root.Right) + s.CountNumberOfNewHashes(root.Nested)
+	if _, ok := s.created[root]; ok {
+		count++
+	}
+	return count
+}
+
+// Fork returns an empty session for a task running concurrently with the session
+func (s *Session) Fork() CostTracker {
+	return NewSession()
+}
+
+// Merge adds the events of a session forked from this one once its task is done
+// Forked sessions are only folded in when the session is read, so that merging costs nothing on the way up the recursion
+func (s *Session) Merge(forked CostTracker) {
+	s.forks = append(s.forks, forked.(*Session))
+}
+
+// flatten folds the forked sessions in, a node exposed or whose height was taken in several sessions is counted once
+// and nodes created in any of them are not counted, so the counts match those of a single session
+func (s *Session) flatten() {
+	if len(s.forks) == 0 {
+		return
+	}
+	forks := s.forks
+	s.forks = nil
+	for len(forks) > 0 {
+		f := forks[len(forks)-1]
+		forks = append(forks[:len(forks)-1], f.forks...)
+		for node, level := range f.created {
+			s.created[node] = level
+		}
+		for node, level := range f.exposed {
+			s.exposed[node] = level
+		}
+		for node, level := range f.heightTaken {
+			s.heightTaken[node] = level
+		}
+		for level, stats := range f.levels {
+			stats.ExposedNodes, stats.HeightTakenNodes = 0, 0
+			s.at(level).add(stats)
+		}
+	}
+	for node := range s.exposed {
+		if _, ok := s.created[node]; ok {
+			delete(s.exposed, node)
+		}
+	}
+	for node := range s.heightTaken {
+		_, created := s.created[node]
+		_, exposed := s.exposed[node]
+		if created || exposed {
+			delete(s.heightTaken, node)
+		}
+	}
+	for level := range s.levels {
+		s.levels[level].ExposedNodes = 0
+		s.levels[level].HeightTakenNodes = 0
+	}
+	for _, level := range s.exposed {
+		s.at(level).ExposedNodes++
+	}
+	for _, level := range s.heightTaken {
+		s.at(level).HeightTakenNodes++
+	}
+}
+
+// levelTracker records the events on the trees nested level deep in the tree measured by a session
+type levelTracker struct {
+	session *Session
+	level   int
+}
+
+func (t *levelTracker) Expose(node *Node) {
+	t.session.expose(node, t.level)
+}
+
+func (t *levelTracker) HeightRead(node *Node) {
+	t.session.heightRead(node, t.level)
+}
+
+func (t *levelTracker) NodeCreated(node *Node) {
+	t.session.nodeCreated(node, t.level)
+}
+
+func (t *levelTracker) Rotation() {
+	t.session.at(t.level).Rotations++
+}
+
+func (t *levelTracker) Split() {
+	t.session.at(t.level).Splits++
+}
+
+func (t *levelTracker) Join() {
+	t.session.at(t.level).Joins++
+}
+
+func (t *levelTracker) Hashed(*Node) {
+	t.session.at(t.level).Hashes++
+}
+
+// Nest returns the tracker recording the events on the trees one level further down
+func (t *levelTracker) Nest() CostTracker {
+	return &levelTracker{session: t.session, level: t.level + 1}
+}
@@ -0,0 +1,147 @@
+package cairo_avl
+
+import (
+	"bytes"
+	"sync"
+	"testing"
+)
+
+func TestSessionsMeasureTheSameTreeIndependently(t *testing.T) {
+	b1 := *(EmbedByteArray([]byte{1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15, 16, 17, 18, 19, 20, 21, 22, 23, 24}))
+	b2 := *(EmbedByteArray([]byte{3, 4, 5, 7, 30, 31, 32, 33, 40, 41, 42, 43}))
+
+	t1 := BuildTreeFromInorder(&b1)
+	D := BuildDictTreeFromInorder(&b2)
+	RootHash(t1, SHA256Hasher, nil)
+
+	operations := []func(*Node, *DictNode, CostTracker) *Node{Union, Difference, Intersection, SymmetricDifference}
+	operations = append(operations, operations...)
+
+	sequential := make([]Stats, len(operations))
+	for i, operation := range operations {
+		session := NewSession()
+		operation(t1, D, session)
+		sequential[i] = session.Stats()
+	}
+	for i := 0; i < len(operations)/2; i++ {
+		if sequential[i] != sequential[i+len(operations)/2] {
+			t.Fatalf("repeated measurements of the same operation differ: %+v, %+v", sequential[i], sequential[i+len(operations)/2])
+		}
+	}
+
+	concurrent := make([]Stats, len(operations))
+	var wg sync.WaitGroup
+	for i, operation := range operations {
+		wg.Add(1)
+		go func(i int, operation func(*Node, *DictNode, CostTracker) *Node) {
+			defer wg.Done()
+			session := NewSession()
+			operation(t1, D, session)
+			concurrent[i] = session.Stats()
+		}(i, operation)
+	}
+	wg.Wait()
+
+	for i := range operations {
+		if concurrent[i] != sequential[i] {
+			t.Fatalf("operation %v measured %+v concurrently and %+v sequentially", i, concurrent[i], sequential[i])
+		}
+	}
+}
+
+// nestedTree builds a tree of width keys extending prefix, each key holding a tree built the same way depth-1 levels deep
+func nestedTree(prefix []byte, depth int, width int) *Node {
+	keys := make([][]byte, width)
+	for j := range keys {
+		keys[j] = append(append([]byte{}, prefix...), byte(j))
+	}
+	T := BuildTreeFromInorder(&keys)
+	if depth > 1 {
+		var nest func(T *Node)
+		nest = func(T *Node) {
+			if T == nil {
+				return
+			}
+			T.Nested = nestedTree(T.Key, depth-1, width)
+			nest(T.Left)
+			nest(T.Right)
+		}
+		nest(T)
+	}
+	return T
+}
+
+// nestedKeys returns the keys of the tree reached by following the path of keys through the nested trees
+func nestedKeys(T *Node, path ...[]byte) [][]byte {
+	for _, k := range path {
+		for T != nil && !bytes.Equal(T.Key, k) {
+			if bytes.Compare(k, T.Key) < 0 {
+				T = T.Left
+			} else {
+				T = T.Right
+			}
+		}
+		if T == nil {
+			return nil
+		}
+		T = T.Nested
+	}
+	return *(GetInorderTraversal(T))
+}
+
+func TestSessionAttributesEventsToNestingLevels(t *testing.T) {
+	// Accounts hold storage slots, which hold sub-maps
+	t1 := nestedTree(nil, 3, 8)
+	RootHash(t1, SHA256Hasher, nil)
+
+	slot := NewDictNode([]byte{2, 3}, []byte{2, 3}, 1, nil, nil)
+	slot.Update = NewDictNode([]byte{2, 3, 9}, []byte{2, 3, 9}, 1, nil, nil)
+	slot.Delete = NewDictNode([]byte{2, 3, 0}, nil, 1, nil, nil)
+
+	newSlot := NewDictNode([]byte{20, 1}, []byte{20, 1}, 1, nil, nil)
+	newSlot.Update = NewDictNode([]byte{20, 1, 1}, []byte{20, 1, 1}, 1, nil, nil)
+	newAccount := NewDictNode([]byte{20}, []byte{20}, 1, nil, nil)
+	newAccount.Update = newSlot
+
+	D := NewDictNode([]byte{2}, []byte{2}, 2, nil, newAccount)
+	D.Update = slot
+
+	session := NewSession()
+	tU := Union(t1, D, session)
+	RootHash(tU, SHA256Hasher, session)
+
+	keys := nestedKeys(tU, []byte{2}, []byte{2, 3})
+	expected := [][]byte{{2, 3, 1}, {2, 3, 2}, {2, 3, 3}, {2, 3, 4}, {2, 3, 5}, {2, 3, 6}, {2, 3, 7}, {2, 3, 9}}
+	if len(keys) != len(expected) {
+		t.Fatalf("slot {2, 3} holds %v, expected %v", keys, expected)
+	}
+	for i := range keys {
+		if !bytes.Equal(keys[i], expected[i]) {
+			t.Fatalf("slot {2, 3} holds %v, expected %v", keys, expected)
+		}
+	}
+	if keys := nestedKeys(tU, []byte{20}, []byte{20, 1}); len(keys) != 1 || !bytes.Equal(keys[0], []byte{20, 1, 1}) {
+		t.Fatalf("slot {20, 1} holds %v, expected [[20 1 1]]", keys)
+	}
+	if keys := nestedKeys(tU, []byte{3}, []byte{3, 3}); len(keys) != 8 {
+		t.Fatalf("slot {3, 3} holds %v, expected it untouched", keys)
+	}
+
+	levels := session.LevelStats()
+	if len(levels) != 3 {
+		t.Fatalf("recorded %v nesting levels, expected 3", len(levels))
+	}
+	var total Stats
+	for level, stats := range levels {
+		if stats.ExposedNodes == 0 || stats.CreatedNodes == 0 || stats.Hashes == 0 {
+			t.Fatalf("level %v recorded %+v", level, stats)
+		}
+		total.add(stats)
+	}
+	if total != session.Stats() {
+		t.Fatalf("levels sum up to %+v, the session recorded %+v", total, session.Stats())
+	}
+	if total.Hashes != session.CountNumberOfNewHashes(tU) {
+		t.Fatalf("recorded %v re-hashes, tU has %v new nodes", total.Hashes, session.CountNumberOfNewHashes(tU))
+	}
+}
@@ -0,0 +1,78 @@
+package cairo_avl
+
+// CostTracker records the events of an operation that a commitment scheme pays for
+// Every method is called on each occurrence of the event, it is up to the tracker to decide what to count
+type CostTracker interface {
+	// Expose is called when an operation opens a node to read its key, value and children
+	Expose(node *Node)
+	// HeightRead is called when an operation reads the height of a node
+	HeightRead(node *Node)
+	// NodeCreated is called for every node an operation creates
+	NodeCreated(node *Node)
+	// Rotation is called for every single rotation
+	Rotation()
+	// Split is called for every call to split
+	Split()
+	// Join is called for every call to join
+	Join()
+	// Hashed is called for every node commitment computed by RootHash
+	Hashed(node *Node)
+}
+
+// Nester is implemented by trackers that attribute the events on nested trees to their nesting level
+type Nester interface {
+	// Nest returns the tracker recording the events on the trees nested one level below those of the tracker
+	Nest() CostTracker
+}
+
+// nest returns the tracker for the nested trees of a tree, the tracker itself unless it implements Nester
+func nest(tracker CostTracker) CostTracker {
+	if n, ok := tracker.(Nester); ok {
+		return n.Nest()
+	}
+	return tracker
+}
+
+// Stats is the structured summary of the events recorded by a Session
+type Stats struct {
+	// ExposedNodes counts the pre-existing nodes opened at least once
+	ExposedNodes int
+	// HeightTakenNodes counts the pre-existing nodes whose height was read but which were never opened
+	HeightTakenNodes int
+	// CreatedNodes counts every node created, including those discarded before the end of the operation
+	CreatedNodes int
+	Rotations    int
+	Splits       int
+	Joins        int
+	Hashes       int
+}
+
+// add sums the events of other into the stats
+func (s *Stats) add(other Stats) {
+	s.ExposedNodes += other.ExposedNodes
+	s.HeightTakenNodes += other.HeightTakenNodes
+	s.CreatedNodes += other.CreatedNodes
+	s.Rotations += other.Rotations
+	s.Splits += other.Splits
+	s.Joins += other.Joins
+	s.Hashes += other.Hashes
+}
+
+// nopTracker ignores every event, it stands in for a nil CostTracker
+type nopTracker struct{}
+
+func (nopTracker) Expose(*Node)      {}
+func (nopTracker) HeightRead(*Node)  {}
+func (nopTracker) NodeCreated(*Node) {}
+func (nopTracker) Rotation()         {}
+func (nopTracker) Split()            {}
+func (nopTracker) Join()             {}
+func (nopTracker) Hashed(*Node)      {}
+
+// orNop returns the tracker, or a tracker ignoring every event when it is nil
+func orNop(tracker CostTracker) CostTracker {
+	if tracker == nil {
+		return nopTracker{}
+	}
+	return tracker
+}
@@ -0,0 +1,222 @@
+package cairo_avl
+
+import (
+	"bytes"
+	"encoding/binary"
+)
+
+// Codec encodes values of type T into the bytes stored and committed by the tree, and decodes them back
+// A key codec must preserve order: bytes.Compare orders two encodings as the keys they encode, otherwise the tree is
+// ordered by the encodings and its operations disagree with the order of the keys. Decode is only ever given bytes
+// produced by Encode
+type Codec[T any] interface {
+	Encode(v T) []byte
+	Decode(b []byte) T
+}
+
+// Uint64Codec encodes a uint64 as its 8 big endian bytes, which preserves order
+type Uint64Codec struct{}
+
+func (Uint64Codec) Encode(v uint64) []byte {
+	b := make([]byte, 8)
+	binary.BigEndian.PutUint64(b, v)
+	return b
+}
+
+func (Uint64Codec) Decode(b []byte) uint64 {
+	return binary.BigEndian.Uint64(b)
+}
+
+// Int64Codec encodes an int64 as its 8 big endian bytes with the sign bit flipped, so negative values sort first
+type Int64Codec struct{}
+
+func (Int64Codec) Encode(v int64) []byte {
+	return Uint64Codec{}.Encode(uint64(v) ^ 1<<63)
+}
+
+func (Int64Codec) Decode(b []byte) int64 {
+	return int64(Uint64Codec{}.Decode(b) ^ 1<<63)
+}
+
+// StringCodec encodes a string as its bytes, which preserves order
+type StringCodec struct{}
+
+func (StringCodec) Encode(v string) []byte {
+	return []byte(v)
+}
+
+func (StringCodec) Decode(b []byte) string {
+	return string(b)
+}
+
+// BytesCodec stores byte slices as they are, Tree[[]byte, []byte] is the byte-slice API of the package
+type BytesCodec struct{}
+
+func (BytesCodec) Encode(v []byte) []byte {
+	return v
+}
+
+func (BytesCodec) Decode(b []byte) []byte {
+	return b
+}
+
+// Pair is a composite key ordered by its first element then by its second, such as an account and a storage slot
+type Pair[A any, B any] struct {
+	First  A
+	Second B
+}
+
+// PairCodec encodes a pair with a codec for each element, which preserves the order of pairs when both codecs preserve
+// the order of their elements
+// The first encoding has its zero bytes escaped as 0x00 0xff and ends with 0x00 0x00, so that it sorts before any
+// encoding it is a prefix of and the second encoding only decides between equal first elements
+type PairCodec[A any, B any] struct {
+	First  Codec[A]
+	Second Codec[B]
+}
+
+func (c PairCodec[A, B]) Encode(v Pair[A, B]) []byte {
+	first := c.First.Encode(v.First)
+	b := make([]byte, 0, len(first)+2)
+	for _, x := range first {
+		b = append(b, x)
+		if x == 0 {
+			b = append(b, 0xff)
+		}
+	}
+	b = append(b, 0, 0)
+	return append(b, c.Second.Encode(v.Second)...)
+}
+
+func (c PairCodec[A, B]) Decode(b []byte) Pair[A, B] {
+	var first []byte
+	for {
+		i := bytes.IndexByte(b, 0)
+		first = append(first, b[:i]...)
+		end := b[i+1] == 0
+		b = b[i+2:]
+		if end {
+			break
+		}
+		first = append(first, 0)
+	}
+	return Pair[A, B]{First: c.First.Decode(first), Second: c.Second.Decode(b)}
+}
+
+// Tree is a persistent tree with keys of type K and values of type V, stored and committed through their codecs
+// Every update returns a new version of the tree and leaves the receiver untouched. Nested trees are left to the
+// byte-slice API on the Root, and a field hasher still needs every encoding to be a field element
+type Tree[K any, V any] struct {
+	root   *Node
+	keys   Codec[K]
+	values Codec[V]
+}
+
+// NewTree is a custom constructor method to initialise an empty tree with codecs for its keys and values
+func NewTree[K any, V any](keys Codec[K], values Codec[V]) *Tree[K, V] {
+	return &Tree[K, V]{keys: keys, values: values}
+}
+
+// with returns a version of the tree with another root
+func (t *Tree[K, V]) with(root *Node) *Tree[K, V] {
+	return &Tree[K, V]{root: root, keys: t.keys, values: t.values}
+}
+
+// Root returns the root node of the tree, nil for an empty tree
+func (t *Tree[K, V]) Root() *Node {
+	return t.root
+}
+
+// Len returns the number of keys of the tree
+func (t *Tree[K, V]) Len() int {
+	count := 0
+	t.Ascend(func(K, V) bool {
+		count++
+		return true
+	})
+	return count
+}
+
+// Ascend calls fn on every key and value in order until it returns false
+func (t *Tree[K, V]) Ascend(fn func(k K, v V) bool) {
+	t.ascend(t.root, fn)
+}
+
+func (t *Tree[K, V]) ascend(root *Node, fn func(k K, v V) bool) bool {
+	if root == nil {
+		return true
+	}
+	return t.ascend(root.Left, fn) && fn(t.keys.Decode(root.Key), t.values.Decode(root.Value)) && t.ascend(root.Right, fn)
+}
+
+// Get returns the value of a key and whether it is in the tree, reporting the cost to the tracker, which may be nil
+func (t *Tree[K, V]) Get(k K, tracker CostTracker) (V, bool) {
+	v, ok := Get(t.root, t.keys.Encode(k), tracker)
+	if !ok {
+		var zero V
+		return zero, false
+	}
+	return t.values.Decode(v), true
+}
+
+// Put inserts a key into the tree, or replaces its value if it is already there
+func (t *Tree[K, V]) Put(k K, v V, tracker CostTracker) *Tree[K, V] {
+	return t.with(Put(t.root, t.keys.Encode(k), t.values.Encode(v), tracker))
+}
+
+// Delete deletes a key from the tree
+func (t *Tree[K, V]) Delete(k K, tracker CostTracker) *Tree[K, V] {
+	return t.with(Delete(t.root, t.keys.Encode(k), tracker))
+}
+
+// Union carries out the union operation on two trees, the other tree wins for keys in both
+func (t *Tree[K, V]) Union(other *Tree[K, V], tracker CostTracker) *Tree[K, V] {
+	return t.with(Union(t.root, other.root.ConvertToDictNode(), tracker))
+}
+
+// Difference carries out the difference operation on two trees
+func (t *Tree[K, V]) Difference(other *Tree[K, V], tracker CostTracker) *Tree[K, V] {
+	return t.with(Difference(t.root, other.root.ConvertToDictNode(), tracker))
+}
+
+// Intersection carries out the intersection operation on two trees, keeping the values of the receiver
+func (t *Tree[K, V]) Intersection(other *Tree[K, V], tracker CostTracker) *Tree[K, V] {
+	return t.with(Intersection(t.root, other.root.ConvertToDictNode(), tracker))
+}
+
+// SymmetricDifference carries out the symmetric difference operation on two trees
+func (t *Tree[K, V]) SymmetricDifference(other *Tree[K, V], tracker CostTracker) *Tree[K, V] {
+	return t.with(SymmetricDifference(t.root, other.root.ConvertToDictNode(), tracker))
+}
+
+// Apply upserts and deletes the keys of a batch in a single pass
+func (t *Tree[K, V]) Apply(batch *Batch[K, V], tracker CostTracker) *Tree[K, V] {
+	return t.with(Apply(t.root, batch.builder.Build(), tracker))
+}
+
+// RootHash returns the commitment of the tree
+func (t *Tree[K, V]) RootHash(hasher Hasher, tracker CostTracker) []byte {
+	return RootHash(t.root, hasher, tracker)
+}
+
+// Batch collects typed records in any order for Apply, the last record of a key wins
+type Batch[K any, V any] struct {
+	builder *BatchBuilder
+	keys    Codec[K]
+	values  Codec[V]
+}
+
+// Batch returns an empty batch with the codecs of the tree
+func (t *Tree[K, V]) Batch() *Batch[K, V] {
+	return &Batch[K, V]{builder: NewBatchBuilder(), keys: t.keys, values: t.values}
+}
+
+// Put upserts a key with a value
+func (b *Batch[K, V]) Put(k K, v V) {
+	b.builder.Put(b.keys.Encode(k), b.values.Encode(v))
+}
+
+// Delete deletes a key along with its nested tree
+func (b *Batch[K, V]) Delete(k K) {
+	b.builder.Delete(b.keys.Encode(k))
+}
@@ -0,0 +1,211 @@
+package cairo_avl
+
+import (
+	"bytes"
+	"math"
+	"testing"
+)
+
+func FuzzTree(f *testing.F) {
+	f.Add([]byte{1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15, 16, 17, 18, 19, 20}, []byte{5, 6, 7, 8, 1, 1, 1, 1, 13, 14, 15, 16})
+
+	f.Fuzz(func(t *testing.T, input1 []byte, input2 []byte) {
+		// Keys are uint64 built from pairs of bytes, so that both trees can share keys
+		tree1 := NewTree[uint64, string](Uint64Codec{}, StringCodec{})
+		tree2 := NewTree[uint64, string](Uint64Codec{}, StringCodec{})
+		batch := tree1.Batch()
+		left := make(map[uint64]string)
+		right := make(map[uint64]string)
+		applied := make(map[uint64]string)
+		for i := 0; i+1 < len(input1); i += 2 {
+			k := uint64(input1[i])<<40 | uint64(input1[i+1])
+			tree1 = tree1.Put(k, "left", nil)
+			left[k] = "left"
+			applied[k] = "left"
+		}
+		for i := 0; i+1 < len(input2); i += 2 {
+			k := uint64(input2[i])<<40 | uint64(input2[i+1])
+			tree2 = tree2.Put(k, "right", nil)
+			right[k] = "right"
+			// Odd records of the batch delete their key, even ones put it
+			if i%4 == 0 {
+				batch.Put(k, "right")
+				applied[k] = "right"
+			} else {
+				batch.Delete(k)
+				delete(applied, k)
+			}
+		}
+
+		union := make(map[uint64]string)
+		difference := make(map[uint64]string)
+		intersection := make(map[uint64]string)
+		symmetricDifference := make(map[uint64]string)
+		for k, v := range left {
+			union[k] = v
+			if _, ok := right[k]; ok {
+				intersection[k] = v
+			} else {
+				difference[k] = v
+				symmetricDifference[k] = v
+			}
+		}
+		for k, v := range right {
+			union[k] = v
+			if _, ok := left[k]; !ok {
+				symmetricDifference[k] = v
+			}
+		}
+
+		results := []struct {
+			name     string
+			tree     *Tree[uint64, string]
+			expected map[uint64]string
+		}{
+			{"union", tree1.Union(tree2, nil), union},
+			{"difference", tree1.Difference(tree2, nil), difference},
+			{"intersection", tree1.Intersection(tree2, nil), intersection},
+			{"symmetric difference", tree1.SymmetricDifference(tree2, nil), symmetricDifference},
+			{"apply", tree1.Apply(batch, nil), applied},
+		}
+
+		for _, result := range results {
+			if result.tree.Len() != len(result.expected) {
+				t.Fatalf("%s has %v keys, expected %v", result.name, result.tree.Len(), len(result.expected))
+			}
+			previous, first := uint64(0), true
+			result.tree.Ascend(func(k uint64, v string) bool {
+				if !first && k <= previous {
+					t.Fatalf("%s: Key: %v comes after %v", result.name, k, previous)
+				}
+				if expected, ok := result.expected[k]; !ok || v != expected {
+					t.Fatalf("%s: Key: %v has value %v, expected %v", result.name, k, v, expected)
+				}
+				previous, first = k, false
+				return true
+			})
+			if !IsBalanced(result.tree.Root()) {
+				t.Fatalf("%s is unbalanced", result.name)
+			}
+		}
+
+		// The inputs are left untouched
+		if tree1.Len() != len(left) || tree2.Len() != len(right) {
+			t.Fatalf("the bulk operations modified their inputs")
+		}
+	})
+}
+
+// account is a composite key ordered by address then storage slot
+type account = Pair[uint64, uint64]
+
+func TestTreeWithCompositeKeys(t *testing.T) {
+	state := NewTree[account, uint64](PairCodec[uint64, uint64]{Uint64Codec{}, Uint64Codec{}}, Uint64Codec{})
+	for _, address := range []uint64{0xb, 0xa, 0xc} {
+		for slot := uint64(3); slot > 0; slot-- {
+			state = state.Put(account{address, slot}, address, nil)
+		}
+	}
+	oldRoot := state.RootHash(PedersenHasher, nil)
+
+	batch := state.Batch()
+	batch.Put(account{0xa, 2}, 42)
+	batch.Put(account{0xd, 1}, 7)
+	batch.Delete(account{0xc, 3})
+	updated := state.Apply(batch, nil)
+
+	if v, ok := updated.Get(account{0xa, 2}, nil); !ok || v != 42 {
+		t.Fatalf("updated value is %v, %v", v, ok)
+	}
+	if _, ok := updated.Get(account{0xc, 3}, nil); ok {
+		t.Fatalf("deleted key is still in the tree")
+	}
+	if v, _ := state.Get(account{0xa, 2}, nil); v != 0xa {
+		t.Fatalf("the batch modified the original state")
+	}
+	if !bytes.Equal(state.RootHash(PedersenHasher, nil), oldRoot) {
+		t.Fatalf("the batch changed the commitment of the original state")
+	}
+
+	var keys []account
+	updated.Ascend(func(k account, _ uint64) bool {
+		keys = append(keys, k)
+		return true
+	})
+	if len(keys) != 9 || keys[0] != (account{0xa, 1}) || keys[8] != (account{0xd, 1}) {
+		t.Fatalf("keys are out of order: %v", keys)
+	}
+}
+
+func TestByteTreeMatchesNodeFunctions(t *testing.T) {
+	tree := NewTree[[]byte, []byte](BytesCodec{}, BytesCodec{})
+	var root *Node
+	for i := 0; i < 100; i++ {
+		k := []byte{byte(i * 37 % 101)}
+		tree = tree.Put(k, []byte{byte(i)}, nil)
+		root = Put(root, k, []byte{byte(i)}, nil)
+	}
+
+	if !bytes.Equal(tree.RootHash(SHA256Hasher, nil), RootHash(root, SHA256Hasher, nil)) {
+		t.Fatalf("the tree and the node functions commit to different roots")
+	}
+	if !IsBalanced(tree.Root()) || !IsValidBST(tree.Root()) {
+		t.Fatalf("the tree is not a balanced BST")
+	}
+}
+
+func TestInt64CodecPreservesOrder(t *testing.T) {
+	values := []int64{math.MinInt64, -1 << 40, -256, -1, 0, 1, 255, 1 << 40, math.MaxInt64}
+	for i, a := range values {
+		if decoded := (Int64Codec{}).Decode(Int64Codec{}.Encode(a)); decoded != a {
+			t.Fatalf("%v decodes to %v", a, decoded)
+		}
+		for _, b := range values[i+1:] {
+			if bytes.Compare(Int64Codec{}.Encode(a), Int64Codec{}.Encode(b)) != -1 {
+				t.Fatalf("the encoding of %v does not sort before the encoding of %v", a, b)
+			}
+		}
+	}
+}
+
+func TestPairCodecPreservesOrder(t *testing.T) {
+	// Variable length first elements, prefixes and zero bytes included, must not let the second element decide
+	pairs := []Pair[string, int64]{
+		{"", math.MaxInt64},
+		{"\x00", -1},
+		{"\x00", 0},
+		{"\x00\x00", math.MinInt64},
+		{"\x00\xff", 0},
+		{"a", math.MinInt64},
+		{"a", -1},
+		{"a", 7},
+		{"a\x00", math.MinInt64},
+		{"a\x00b", 0},
+		{"ab", math.MinInt64},
+		{"b", 0},
+	}
+	codec := PairCodec[string, int64]{StringCodec{}, Int64Codec{}}
+	for i, a := range pairs {
+		if decoded := codec.Decode(codec.Encode(a)); decoded != a {
+			t.Fatalf("%q decodes to %q", a, decoded)
+		}
+		for _, b := range pairs[i+1:] {
+			if bytes.Compare(codec.Encode(a), codec.Encode(b)) != -1 {
+				t.Fatalf("the encoding of %q does not sort before the encoding of %q", a, b)
+			}
+		}
+	}
+
+	tree := NewTree[Pair[string, int64], string](codec, StringCodec{})
+	for i := len(pairs) - 1; i >= 0; i-- {
+		tree = tree.Put(pairs[i], pairs[i].First, nil)
+	}
+	i := 0
+	tree.Ascend(func(k Pair[string, int64], _ string) bool {
+		if k != pairs[i] {
+			t.Fatalf("key %v of the tree is %q, expected %q", i, k, pairs[i])
+		}
+		i++
+		return true
+	})
+}
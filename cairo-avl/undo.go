@@ -0,0 +1,250 @@
+package cairo_avl
+
+import (
+	"bytes"
+	"errors"
+)
+
+// ErrUndoMismatch is returned when an undo is restored on a tree that does not hold the subtrees it shares with T0
+var ErrUndoMismatch = errors.New("tree does not match the undo")
+
+// Undo holds what a union discarded from T0
+// Batch is the batch that Apply uses to restore the key set and the values of T0 along with its nested trees. Applying it
+// rebalances the tree like any batch, so the result only commits to the root hash of T0 when it ends up with its shape
+// Nodes are the nodes of T0 that the union replaced, in pre-order, each with its fields, the commitments of its children
+// and nested tree and its own commitment, and flags telling which of those follow as nodes of the undo. Every other
+// subtree of T0 is still in the result of the union, so Restore rebuilds T0 with its shape and checks it against Root
+type Undo struct {
+	Root  []byte
+	Batch *DictNode
+	Nodes []WitnessNode
+}
+
+// UnionWithUndo is Union also returning the undo that restores T0 from the result
+// T0 is committed with the hasher first, and the undo is collected without reporting to the tracker, since it is
+// bookkeeping outside the operation
+func UnionWithUndo(T0 *Node, D *DictNode, hasher Hasher, tracker CostTracker) (*Node, *Undo) {
+	u := &Undo{Root: RootHash(T0, hasher, nil), Batch: undoBatch(T0, D)}
+	T := Union(T0, D, tracker)
+
+	// The nodes created by the union have no commitment yet, the subtrees below them come from T0
+	shared := make(map[*Node]bool)
+	collectShared(T, hasher, shared)
+	collectUndo(T0, shared, hasher, u)
+	return T, u
+}
+
+// collectShared walks down from the root through the nodes without a commitment and records the committed subtrees below
+func collectShared(root *Node, hasher Hasher, shared map[*Node]bool) {
+	if root == nil {
+		return
+	}
+	if root.cachedHash(hasher) != nil {
+		shared[root] = true
+		return
+	}
+	collectShared(root.Left, hasher, shared)
+	collectShared(root.Right, hasher, shared)
+	collectShared(root.Nested, hasher, shared)
+}
+
+// collectUndo walks down from the root through the nodes missing from the result and records them in pre-order
+// Every node of the undo is opened, so it is marked exposed
+func collectUndo(root *Node, shared map[*Node]bool, hasher Hasher, u *Undo) {
+	if !replaced(root, shared) {
+		return
+	}
+	u.Nodes = append(u.Nodes, WitnessNode{
+		Exposed:       true,
+		Key:           root.Key,
+		Value:         root.Value,
+		Height:        root.Height,
+		Left:          RootHash(root.Left, hasher, nil),
+		Right:         RootHash(root.Right, hasher, nil),
+		Nested:        RootHash(root.Nested, hasher, nil),
+		Hash:          RootHash(root, hasher, nil),
+		LeftFollows:   replaced(root.Left, shared),
+		RightFollows:  replaced(root.Right, shared),
+		NestedFollows: replaced(root.Nested, shared),
+	})
+	collectUndo(root.Left, shared, hasher, u)
+	collectUndo(root.Right, shared, hasher, u)
+	collectUndo(root.Nested, shared, hasher, u)
+}
+
+// replaced reports whether a node of T0 is missing from the result of the union
+func replaced(node *Node, shared map[*Node]bool) bool {
+	return node != nil && !shared[node]
+}
+
+// Restore rebuilds T0 from the result T of the union the undo was collected for, sharing the subtrees T0 and T have
+// in common, and checks the rebuilt tree against the root hash of T0
+// T is committed with the hasher the undo was collected with
+func (u *Undo) Restore(T *Node, hasher Hasher) (*Node, error) {
+	RootHash(T, hasher, nil)
+	wanted := map[string]bool{string(u.Root): true}
+	for _, node := range u.Nodes {
+		wanted[string(node.Left)] = true
+		wanted[string(node.Right)] = true
+		wanted[string(node.Nested)] = true
+	}
+	delete(wanted, "")
+	// The union may recreate a node of T0 as it was, the subtrees it shares with T0 are then found below it
+	recreated := make(map[string]bool)
+	for _, node := range u.Nodes {
+		recreated[string(node.Hash)] = true
+	}
+	found := make(map[string]*Node)
+	findShared(T, hasher, wanted, recreated, found)
+
+	next := 0
+	T0 := u.rebuild(u.Root, len(u.Nodes) > 0, found, &next)
+	if next != len(u.Nodes) || !bytes.Equal(RootHash(T0, hasher, nil), u.Root) {
+		return nil, ErrUndoMismatch
+	}
+	return T0, nil
+}
+
+// findShared walks down from the root until it reaches the subtrees with a wanted commitment, going on below those
+// that may be recreated nodes of the undo
+func findShared(root *Node, hasher Hasher, wanted map[string]bool, recreated map[string]bool, found map[string]*Node) {
+	if root == nil {
+		return
+	}
+	hash := RootHash(root, hasher, nil)
+	if wanted[string(hash)] {
+		found[string(hash)] = root
+		if !recreated[string(hash)] {
+			return
+		}
+	}
+	findShared(root.Left, hasher, wanted, recreated, found)
+	findShared(root.Right, hasher, wanted, recreated, found)
+	findShared(root.Nested, hasher, wanted, recreated, found)
+}
+
+// rebuild rebuilds the subtree committed to by hash, consuming the undo nodes in the pre-order they were collected in
+// A subtree whose undo node does not follow is taken from the shared subtrees, a missing one is left out and fails the
+// root hash check
+func (u *Undo) rebuild(hash []byte, follows bool, found map[string]*Node, next *int) *Node {
+	if len(hash) == 0 {
+		return nil
+	}
+	if !follows || *next >= len(u.Nodes) {
+		return found[string(hash)]
+	}
+	entry := &u.Nodes[*next]
+	*next++
+
+	node := &Node{Key: entry.Key, Value: entry.Value, Height: entry.Height}
+	node.Left = u.rebuild(entry.Left, entry.LeftFollows, found, next)
+	node.Right = u.rebuild(entry.Right, entry.RightFollows, found, next)
+	node.Nested = u.rebuild(entry.Nested, entry.NestedFollows, found, next)
+	return node
+}
+
+// Encode serialises an undo as the root hash of T0, the batch and the replaced nodes
+func (u *Undo) Encode() []byte {
+	buf := appendBytes(nil, u.Root)
+	buf = appendDict(buf, u.Batch)
+	for _, node := range u.Nodes {
+		buf = appendWitnessNode(buf, node)
+	}
+	return buf
+}
+
+// DecodeUndo reads back an undo serialised with Encode
+func DecodeUndo(b []byte) (*Undo, error) {
+	d := &decoder{buf: b}
+	u := &Undo{Root: d.readBytes(), Batch: d.readDict()}
+	for len(d.buf) > 0 && d.err == nil {
+		u.Nodes = append(u.Nodes, d.readWitnessNode())
+	}
+	if d.err != nil {
+		return nil, d.err
+	}
+	return u, nil
+}
+
+// undoBatch returns the batch that Apply uses to undo the union of D into T0, deleting the keys the union inserted and
+// restoring the values and nested trees it overwrote
+func undoBatch(T0 *Node, D *DictNode) *DictNode {
+	entries := make([]*DictNode, 0)
+	for _, d := range D.entries() {
+		old := find(T0, d.Key)
+		if old == nil {
+			entries = append(entries, &DictNode{Key: d.Key, Op: OpDelete})
+			continue
+		}
+		entry := &DictNode{Key: d.Key, Value: old.Value}
+		entry.Update, entry.Delete = undoNested(old.Nested, d.Update, d.Delete)
+		entries = append(entries, entry)
+	}
+	return balanceDict(entries)
+}
+
+// undoNested returns the nested updates and deletes that undo applying DD and then DU to the nested tree TN
+func undoNested(TN *Node, DU *DictNode, DD *DictNode) (*DictNode, *DictNode) {
+	deleted := make(map[string]*DictNode)
+	for _, d := range DD.entries() {
+		deleted[string(d.Key)] = d
+	}
+	updates := make([]*DictNode, 0)
+	deletes := make([]*DictNode, 0)
+	restore := func(old *Node) {
+		updates = append(updates, &DictNode{Key: old.Key, Value: old.Value, Update: old.Nested.toDict()})
+	}
+	for _, u := range DU.entries() {
+		d := deleted[string(u.Key)]
+		delete(deleted, string(u.Key))
+		old := find(TN, u.Key)
+		switch {
+		case old == nil:
+			deletes = append(deletes, &DictNode{Key: u.Key})
+		case d != nil:
+			// The key was replaced, or its nested tree changed twice, so it is replaced back
+			deletes = append(deletes, &DictNode{Key: u.Key})
+			restore(old)
+		default:
+			entry := &DictNode{Key: u.Key, Value: old.Value}
+			entry.Update, entry.Delete = undoNested(old.Nested, u.Update, u.Delete)
+			updates = append(updates, entry)
+		}
+	}
+	for _, d := range deleted {
+		old := find(TN, d.Key)
+		switch {
+		case old == nil:
+		case d.Delete == nil:
+			restore(old)
+		default:
+			entry := &DictNode{Key: d.Key, Value: old.Value}
+			entry.Update, entry.Delete = undoNested(old.Nested, nil, d.Delete)
+			updates = append(updates, entry)
+		}
+	}
+	return balanceDict(updates), balanceDict(deletes)
+}
+
+// find returns the node of a key in a tree, nil when it is not there
+func find(T *Node, k []byte) *Node {
+	for T != nil {
+		switch bytes.Compare(k, T.Key) {
+		case 0:
+			return T
+		case -1:
+			T = T.Left
+		default:
+			T = T.Right
+		}
+	}
+	return nil
+}
+
+// toDict returns the dict tree inserting a tree, the nested trees becoming nested updates
+func (n *Node) toDict() *DictNode {
+	if n == nil {
+		return nil
+	}
+	return &DictNode{Key: n.Key, Value: n.Value, Left: n.Left.toDict(), Right: n.Right.toDict(), Update: n.Nested.toDict(), Height: n.Height}
+}
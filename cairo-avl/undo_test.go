@@ -0,0 +1,115 @@
+package cairo_avl
+
+import (
+	"bytes"
+	"testing"
+)
+
+func FuzzUnionWithUndo(f *testing.F) {
+	f.Add([]byte{2, 1, 0, 3, 1, 2, 4, 2, 1, 5, 0, 1, 6, 3, 2}, []byte{12, 5, 1, 14, 4, 2})
+
+	f.Fuzz(func(t *testing.T, records []byte, nested []byte) {
+		t1 := recordsTree()
+		// The nested trees of some keys of the tree are nested themselves
+		for i := 0; i+1 < len(nested); i += 2 {
+			if node := find(t1, []byte{nested[i] % 16}); node != nil {
+				if sub := find(node.Nested, []byte{nested[i+1] % 8}); sub != nil {
+					sub.Nested = nestedTree(sub.Key, 2, 3)
+				}
+			}
+		}
+		before := render(t1)
+
+		// Union ignores the op of the entries, so the batch has no deletes
+		D := batchFromRecords(records, 3)
+		tU, undo := UnionWithUndo(t1, D, SHA256Hasher, nil)
+		checkDict(t, undo.Batch)
+
+		tA := Apply(tU, undo.Batch, nil)
+		if after := render(tA); after != before {
+			t.Fatalf("applying the undo batch gives %v, expected %v", after, before)
+		}
+		if !IsBalanced(tA) || !IsValidBST(tA) {
+			t.Fatalf("tA with root: %v is not a balanced BST", tA)
+		}
+
+		tR, err := undo.Restore(tU, SHA256Hasher)
+		if err != nil {
+			t.Fatalf("could not restore t1: %v", err)
+		}
+		if after := render(tR); after != before {
+			t.Fatalf("undoing the union gives %v, expected %v", after, before)
+		}
+		if !bytes.Equal(RootHash(tR, SHA256Hasher, nil), RootHash(t1, SHA256Hasher, nil)) {
+			t.Fatalf("the restored tree does not have the root hash of t1")
+		}
+		if render(t1) != before || render(tU) != render(Union(t1, D, nil)) {
+			t.Fatalf("the union or the undo changed their inputs")
+		}
+	})
+}
+
+func TestRestoreRejectsAnotherTree(t *testing.T) {
+	t1 := recordsTree()
+	D := batchFromRecords([]byte{0, 0, 3}, 3)
+	tU, undo := UnionWithUndo(t1, D, SHA256Hasher, nil)
+
+	// Changing a key the union left alone changes a subtree the undo shares with tU
+	if _, err := undo.Restore(Put(tU, []byte{14}, []byte{1}, nil), SHA256Hasher); err != ErrUndoMismatch {
+		t.Fatalf("restoring on another tree returned %v", err)
+	}
+	if _, err := undo.Restore(tU, SHA256Hasher); err != nil {
+		t.Fatalf("could not restore t1: %v", err)
+	}
+}
+
+func TestUndoEncodeRoundTrip(t *testing.T) {
+	t1 := recordsTree()
+	D := batchFromRecords([]byte{2, 1, 0, 3, 1, 2, 4, 2, 1, 20, 0, 1}, 3)
+	tU, undo := UnionWithUndo(t1, D, SHA256Hasher, nil)
+
+	decoded, err := DecodeUndo(undo.Encode())
+	if err != nil {
+		t.Fatalf("could not decode the undo: %v", err)
+	}
+	if !bytes.Equal(decoded.Encode(), undo.Encode()) {
+		t.Fatalf("the decoded undo encodes differently")
+	}
+	if render(Apply(tU, decoded.Batch, nil)) != render(t1) {
+		t.Fatalf("the decoded undo batch does not restore t1")
+	}
+	tR, err := decoded.Restore(tU, SHA256Hasher)
+	if err != nil {
+		t.Fatalf("could not restore t1 from the decoded undo: %v", err)
+	}
+	if !bytes.Equal(RootHash(tR, SHA256Hasher, nil), RootHash(t1, SHA256Hasher, nil)) {
+		t.Fatalf("the restored tree does not have the root hash of t1")
+	}
+
+	encoded := undo.Encode()
+	if _, err := DecodeUndo(encoded[:len(encoded)-1]); err != ErrMalformedEncoding {
+		t.Fatalf("decoding a truncated undo returned %v", err)
+	}
+}
+
+func TestRestoreWithDuplicateNestedTrees(t *testing.T) {
+	b := [][]byte{{1}, {2}, {3}}
+	t1 := BuildTreeFromInorder(&b)
+	nested := [][]byte{{10}, {11}, {12}}
+	t1.Nested = BuildTreeFromInorder(&nested)
+	t1.Right.Nested = BuildTreeFromInorder(&nested)
+	before := render(t1)
+
+	// The nested tree of key 2 is replaced while key 3 keeps an equal one
+	batch := NewBatchBuilder()
+	batch.NestedPut([]byte{2}, []byte{13}, []byte{13})
+	tU, undo := UnionWithUndo(t1, batch.Build(), SHA256Hasher, nil)
+
+	tR, err := undo.Restore(tU, SHA256Hasher)
+	if err != nil {
+		t.Fatalf("could not restore t1: %v", err)
+	}
+	if after := render(tR); after != before {
+		t.Fatalf("undoing the union gives %v, expected %v", after, before)
+	}
+}
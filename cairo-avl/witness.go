@@ -0,0 +1,153 @@
+package cairo_avl
+
+// WitnessNode is a pre-existing node a bulk operation relies on
+// Every node carries its fields, the commitments of its children and nested tree and its own commitment, so that a node
+// whose height was only taken is checked against its commitment without being opened. The Follows flags of an exposed
+// node tell which of its children and nested tree have their own witness node next in pre-order, any other is pruned
+type WitnessNode struct {
+	Exposed       bool
+	Key           []byte
+	Value         []byte
+	Height        int
+	Left          []byte
+	Right         []byte
+	Nested        []byte
+	Hash          []byte
+	LeftFollows   bool
+	RightFollows  bool
+	NestedFollows bool
+}
+
+// Flags of the tag byte of an encoded witness node
+const (
+	exposedFlag byte = 1 << iota
+	leftFollowsFlag
+	rightFollowsFlag
+	nestedFollowsFlag
+)
+
+// Witness holds the pre-existing nodes opened by a bulk operation, in pre-order, with the root hashes before and after it
+type Witness struct {
+	OldRoot []byte
+	NewRoot []byte
+	Nodes   []WitnessNode
+}
+
+// BuildWitness collects the nodes of T0 that the bulk operation measured by the session, producing T, exposed or took the height of
+// T0 must have been committed with RootHash before the operation
+func BuildWitness(T0 *Node, T *Node, session *Session, hasher Hasher) *Witness {
+	w := &Witness{
+		OldRoot: RootHash(T0, hasher, nil),
+		NewRoot: RootHash(T, hasher, nil),
+	}
+	collectWitness(T0, session, hasher, w)
+	return w
+}
+
+// collectWitness walks down from the root through exposed nodes, which are always reached through an exposed parent
+func collectWitness(root *Node, session *Session, hasher Hasher, w *Witness) {
+	if !inWitness(root, session) {
+		return
+	}
+	exposed := session.Exposed(root)
+	node := WitnessNode{
+		Exposed: exposed,
+		Key:     root.Key,
+		Value:   root.Value,
+		Height:  root.Height,
+		Left:    RootHash(root.Left, hasher, nil),
+		Right:   RootHash(root.Right, hasher, nil),
+		Nested:  RootHash(root.Nested, hasher, nil),
+		Hash:    RootHash(root, hasher, nil),
+	}
+	if exposed {
+		node.LeftFollows = inWitness(root.Left, session)
+		node.RightFollows = inWitness(root.Right, session)
+		node.NestedFollows = inWitness(root.Nested, session)
+	}
+	w.Nodes = append(w.Nodes, node)
+	if !exposed {
+		return
+	}
+	collectWitness(root.Left, session, hasher, w)
+	collectWitness(root.Right, session, hasher, w)
+	collectWitness(root.Nested, session, hasher, w)
+}
+
+// inWitness reports whether the operation exposed a node or took its height
+func inWitness(node *Node, session *Session) bool {
+	return node != nil && (session.Exposed(node) || session.HeightTaken(node))
+}
+
+// Encode serialises a witness as the old root, the new root and the nodes
+func (w *Witness) Encode() []byte {
+	var buf []byte
+	buf = appendBytes(buf, w.OldRoot)
+	buf = appendBytes(buf, w.NewRoot)
+	for _, node := range w.Nodes {
+		buf = appendWitnessNode(buf, node)
+	}
+	return buf
+}
+
+// DecodeWitness reads back a witness serialised with Encode
+func DecodeWitness(b []byte) (*Witness, error) {
+	d := &decoder{buf: b}
+	w := &Witness{OldRoot: d.readBytes(), NewRoot: d.readBytes()}
+	for len(d.buf) > 0 && d.err == nil {
+		w.Nodes = append(w.Nodes, d.readWitnessNode())
+	}
+	if d.err != nil {
+		return nil, d.err
+	}
+	return w, nil
+}
+
+// appendWitnessNode appends a node after a tag byte holding its flags
+func appendWitnessNode(buf []byte, node WitnessNode) []byte {
+	var tag byte
+	if node.Exposed {
+		tag |= exposedFlag
+	}
+	if node.LeftFollows {
+		tag |= leftFollowsFlag
+	}
+	if node.RightFollows {
+		tag |= rightFollowsFlag
+	}
+	if node.NestedFollows {
+		tag |= nestedFollowsFlag
+	}
+	buf = append(buf, tag)
+	buf = appendBytes(buf, node.Key)
+	buf = appendBytes(buf, node.Value)
+	buf = appendInt(buf, node.Height)
+	buf = appendBytes(buf, node.Left)
+	buf = appendBytes(buf, node.Right)
+	buf = appendBytes(buf, node.Nested)
+	return appendBytes(buf, node.Hash)
+}
+
+// readWitnessNode reads back a node written by appendWitnessNode
+// Only an exposed node has children following it, any other flag is malformed
+func (d *decoder) readWitnessNode() WitnessNode {
+	tag := d.readByte()
+	if tag >= nestedFollowsFlag<<1 || (tag&exposedFlag == 0 && tag != 0) {
+		d.err = ErrMalformedEncoding
+		return WitnessNode{}
+	}
+	node := WitnessNode{
+		Exposed:       tag&exposedFlag != 0,
+		LeftFollows:   tag&leftFollowsFlag != 0,
+		RightFollows:  tag&rightFollowsFlag != 0,
+		NestedFollows: tag&nestedFollowsFlag != 0,
+	}
+	node.Key = d.readBytes()
+	node.Value = d.readBytes()
+	node.Height = d.readInt()
+	node.Left = d.readBytes()
+	node.Right = d.readBytes()
+	node.Nested = d.readBytes()
+	node.Hash = d.readBytes()
+	return node
+}
@@ -0,0 +1,50 @@
+package cairo_avl
+
+import (
+	"bytes"
+	"testing"
+)
+
+func FuzzBuildWitness(f *testing.F) {
+	f.Add([]byte{1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15, 16, 17, 18, 19, 20}, []byte{5, 6, 7, 8, 1, 1, 1, 1, 13, 14, 15, 16})
+
+	f.Fuzz(func(t *testing.T, input1 []byte, input2 []byte) {
+		b1 := *(EmbedByteArray(input1))
+		b2 := *(EmbedByteArray(input2))
+
+		t1 := BuildTreeFromInorder(&b1)
+		D := BuildDictTreeFromInorder(&b2)
+		RootHash(t1, SHA256Hasher, nil)
+
+		session := NewSession()
+		tU := Union(t1, D, session)
+		stats := session.Stats()
+		w := BuildWitness(t1, tU, session, SHA256Hasher)
+
+		exposed, heightTaken := 0, 0
+		for _, node := range w.Nodes {
+			if node.Exposed {
+				exposed++
+			} else {
+				heightTaken++
+			}
+			if !bytes.Equal(node.Hash, hashNode(SHA256Hasher, node.Key, node.Value, node.Height, node.Left, node.Right, node.Nested)) {
+				t.Fatalf("Key: %v has a commitment that does not match its fields", node.Key)
+			}
+		}
+		if exposed != stats.ExposedNodes {
+			t.Fatalf("witness holds %v exposed nodes, union exposed %v", exposed, stats.ExposedNodes)
+		}
+		if heightTaken != stats.HeightTakenNodes {
+			t.Fatalf("witness holds %v height taken nodes, union took the height of %v", heightTaken, stats.HeightTakenNodes)
+		}
+
+		decoded, err := DecodeWitness(w.Encode())
+		if err != nil {
+			t.Fatalf("could not decode the witness: %v", err)
+		}
+		if !bytes.Equal(decoded.Encode(), w.Encode()) {
+			t.Fatalf("witness changed through encoding")
+		}
+	})
+}
@@ -1,5 +1,10 @@
 module github.com/leonardchinonso/bulkOperations
 
-go 1.16
+go 1.18
 
-require gopkg.in/eapache/queue.v1 v1.1.0
+require (
+	golang.org/x/crypto v0.1.0
+	gopkg.in/eapache/queue.v1 v1.1.0
+)
+
+require golang.org/x/sys v0.1.0 // indirect
@@ -3,13 +3,24 @@ package main
 import (
 	"bufio"
 	"bytes"
+	"flag"
 	"fmt"
 	"io"
 	"os"
+	"runtime"
+	"time"
 
 	avl2 "github.com/leonardchinonso/bulkOperations/cairo-avl"
 )
 
+var (
+	mode        = flag.String("mode", "count", "comparison to run: count, hashers, parallel, sequential, apply or compose")
+	hasherName  = flag.String("hasher", "sha256", "hasher used to commit the trees for proofs and witnesses")
+	witnessFile = flag.String("witness", "", "file to write the serialised union witness to")
+	costModel   = flag.String("cost", "", "cost model used to estimate Cairo steps and gas: a JSON file, or the illustrative pedersen or poseidon preset; no estimate when empty")
+	cutoff      = flag.Int("cutoff", 4, "height of the update tree below which the parallel operations stop forking")
+)
+
 func handleError(err error) {
 	if err != nil {
 		panic(err.Error())
@@ -52,33 +63,81 @@ func convertToBytes(fileName string) []byte {
 }
 
 func main() {
-	if len(os.Args) != 3 {
+	flag.Parse()
+	if flag.NArg() != 2 {
 		panic("Invalid number of arguments")
 	}
 
-	b1 := *(avl2.EmbedByteArray(convertToBytes(os.Args[1])))
-	b2 := *(avl2.EmbedByteArray(convertToBytes(os.Args[2])))
+	b1 := *(avl2.EmbedByteArray(convertToBytes(flag.Arg(0))))
+	b2 := *(avl2.EmbedByteArray(convertToBytes(flag.Arg(1))))
 
 	if len(b1) == 0 || len(b2) == 0 {
 		panic("One of the input files does not have enough unique data!")
 	}
 
+	hasher, err := avl2.HasherByName(*hasherName)
+	handleError(err)
+
+	switch *mode {
+	case "count":
+		countHashes(b1, b2, hasher, loadCostModel(*costModel))
+	case "hashers":
+		compareHashers(b1, b2)
+	case "parallel":
+		compareParallel(b1, b2, *cutoff)
+	case "sequential":
+		compareSequential(b1, b2, hasher)
+	case "apply":
+		compareApply(b1, b2, hasher)
+	case "compose":
+		compareCompose(b1, b2, hasher)
+	default:
+		panic("Unknown mode: " + *mode)
+	}
+}
+
+// loadCostModel returns the built-in cost model with the given name, or reads one from a JSON file, nil for no name
+func loadCostModel(name string) *avl2.CostModel {
+	if name == "" {
+		return nil
+	}
+	if model, err := avl2.CostModelByName(name); err == nil {
+		return model
+	}
+	b, err := os.ReadFile(name)
+	handleError(err)
+	model, err := avl2.ParseCostModel(b)
+	handleError(err)
+	return model
+}
+
+// countHashes counts the nodes exposed, height taken and created by the bulk operations and estimates their cost
+func countHashes(b1 [][]byte, b2 [][]byte, hasher avl2.Hasher, model *avl2.CostModel) {
 	fmt.Println("# UNION:")
 	t1 := avl2.BuildTreeFromInorder(&b1)
 	t2 := avl2.BuildDictTreeFromInorder(&b2)
 
 	t2NodeType := (*t2).ConvertToNode()
+	avl2.RootHash(t1, hasher, nil)
 
-	numOfExposedNodesInUnion := 0
-	numOfHeightTakenNodesInUnion := 0
-	newNodesCountInUnion := 0
-	tU := avl2.Union(t1, t2, &numOfExposedNodesInUnion, &numOfHeightTakenNodesInUnion)
-	avl2.CountNumberOfNewHashes(tU, &newNodesCountInUnion)
+	sessionInUnion := avl2.NewSession()
+	tU := avl2.Union(t1, t2, sessionInUnion)
+	newNodesCountInUnion := sessionInUnion.CountNumberOfNewHashes(tU)
+	avl2.RootHash(tU, hasher, sessionInUnion)
 	fmt.Println("Number of nodes in the original tree: ", len(b1))
 	fmt.Println("Number of nodes in the update tree: ", len(b2))
 	fmt.Println("number of re-hashes to be made: ", newNodesCountInUnion)
-	fmt.Println("number of nodes exposed in union: ", numOfExposedNodesInUnion)
-	fmt.Println("number of nodes with height taken in union: ", numOfHeightTakenNodesInUnion)
+	printStats("union", sessionInUnion.Stats())
+	printCost("union", model, sessionInUnion.Stats())
+	printMultiProofSize(t1, t2, hasher)
+
+	if *witnessFile != "" {
+		witness := avl2.BuildWitness(t1, tU, sessionInUnion, hasher)
+		encoded := witness.Encode()
+		handleError(os.WriteFile(*witnessFile, encoded, 0644))
+		fmt.Println("number of nodes in the union witness: ", len(witness.Nodes))
+		fmt.Println("size of the union witness in bytes: ", len(encoded))
+	}
 
 	// Check that all nodes in tU are either in t1 or t2
 	for _, key := range *(avl2.GetInorderTraversal(tU)) {
@@ -114,51 +173,45 @@ func main() {
 		fmt.Println("tU is an unbalanced BST")
 	}
 
-	// DIFFERENCE: Yet to count the hashes for the difference operation
+	// DIFFERENCE: measured on the same trees in a session of its own
 	fmt.Println()
 	fmt.Println("# DIFFERENCE:")
 
-	tt1 := avl2.BuildTreeFromInorder(&b1)
-	tt2 := avl2.BuildDictTreeFromInorder(&b2)
-
-	tt2NodeType := (*tt2).ConvertToNode()
-
-	numOfExposedNodesInDifference := 0
-	numOfHeightTakenNodesInDifference := 0
-	newNodesCountInDifference := 0
-	tD := avl2.Difference(tt1, tt2, &numOfExposedNodesInDifference, &numOfHeightTakenNodesInDifference)
-	avl2.CountNumberOfNewHashes(tD, &newNodesCountInDifference)
+	sessionInDifference := avl2.NewSession()
+	tD := avl2.Difference(t1, t2, sessionInDifference)
+	newNodesCountInDifference := sessionInDifference.CountNumberOfNewHashes(tD)
+	avl2.RootHash(tD, hasher, sessionInDifference)
 	fmt.Println("Number of nodes in the original tree: ", len(b1))
 	fmt.Println("Number of nodes in the update tree: ", len(b2))
 	fmt.Println("number of re-hashes to be made: ", newNodesCountInDifference)
-	fmt.Println("number of nodes exposed in difference: ", numOfExposedNodesInDifference)
-	fmt.Println("number of nodes with height taken in difference: ", numOfHeightTakenNodesInDifference)
+	printStats("difference", sessionInDifference.Stats())
+	printCost("difference", model, sessionInDifference.Stats())
 
 	// Check that all nodes in t1 are either in tD or t2 but not both
-	for _, key := range *(avl2.GetInorderTraversal(tt1)) {
+	for _, key := range *(avl2.GetInorderTraversal(t1)) {
 		in_tD := avl2.IsInTree(tD, &key)
-		in_tt2 := avl2.IsInTree(tt2NodeType, &key)
+		in_t2 := avl2.IsInTree(t2NodeType, &key)
 
-		if !in_tD && !in_tt2 {
-			fmt.Printf("Key: %v not in tD and not in tt2", key)
+		if !in_tD && !in_t2 {
+			fmt.Printf("Key: %v not in tD and not in t2", key)
 		}
 
-		if in_tD && in_tt2 {
-			fmt.Printf("Key: %v in tD and tt2", key)
+		if in_tD && in_t2 {
+			fmt.Printf("Key: %v in tD and t2", key)
 		}
 	}
 
 	// Check that all nodes in t2 are either in tD or t1 but not both
-	for _, key := range *(avl2.GetInorderTraversal(tt2NodeType)) {
+	for _, key := range *(avl2.GetInorderTraversal(t2NodeType)) {
 		in_tD := avl2.IsInTree(tD, &key)
-		in_tt1 := avl2.IsInTree(tt2NodeType, &key)
+		in_t1 := avl2.IsInTree(t2NodeType, &key)
 
-		if !in_tD && !in_tt1 {
-			fmt.Printf("Key: %v not in tD and not in tt1", key)
+		if !in_tD && !in_t1 {
+			fmt.Printf("Key: %v not in tD and not in t1", key)
 		}
 
-		if in_tD && in_tt1 {
-			fmt.Printf("Key: %v in tD and tt1", key)
+		if in_tD && in_t1 {
+			fmt.Printf("Key: %v in tD and t1", key)
 		}
 	}
 
@@ -171,3 +224,306 @@ func main() {
 	}
 
 }
+
+// printStats prints the events recorded during a bulk operation
+func printStats(operation string, stats avl2.Stats) {
+	fmt.Println("number of nodes exposed in "+operation+": ", stats.ExposedNodes)
+	fmt.Println("number of nodes with height taken in "+operation+": ", stats.HeightTakenNodes)
+	fmt.Println("number of nodes created in "+operation+": ", stats.CreatedNodes)
+	fmt.Println("number of rotations in "+operation+": ", stats.Rotations)
+	fmt.Println("number of splits in "+operation+": ", stats.Splits)
+	fmt.Println("number of joins in "+operation+": ", stats.Joins)
+}
+
+// printCost prints the Cairo steps and L1 gas a cost model estimates for a bulk operation, nothing without a model
+func printCost(operation string, model *avl2.CostModel, stats avl2.Stats) {
+	if model == nil {
+		return
+	}
+	cost := model.Estimate(stats)
+	name := model.Name
+	if model.Illustrative {
+		name += ", illustrative"
+	}
+	fmt.Printf("estimated cairo steps in %s (%s): %.0f\n", operation, name, cost.Steps)
+	fmt.Printf("estimated L1 gas in %s (%s): %.2f\n", operation, name, cost.Gas)
+	if model.Illustrative {
+		fmt.Println("the " + model.Name + " weights are made up, these estimates only compare operations with each other")
+	}
+}
+
+// printMultiProofSize reports the size of the multiproof covering every key of the update tree
+func printMultiProofSize(t1 *avl2.Node, t2 *avl2.DictNode, hasher avl2.Hasher) {
+	proof := avl2.ProveBatch(t1, t2, hasher)
+	fmt.Println("number of nodes opened by the batch multiproof: ", proof.NumOfOpenedNodes())
+	fmt.Println("size of the batch multiproof in bytes: ", proof.Size())
+}
+
+// compareHashers commits the trees with every built-in hasher and reports the root hashes and timings of the bulk operations
+func compareHashers(b1 [][]byte, b2 [][]byte) {
+	operations := []struct {
+		name string
+		run  func(T0 *avl2.Node, D *avl2.DictNode, tracker avl2.CostTracker) *avl2.Node
+	}{
+		{"UNION", avl2.Union},
+		{"DIFFERENCE", avl2.Difference},
+		{"INTERSECTION", avl2.Intersection},
+		{"SYMMETRIC DIFFERENCE", avl2.SymmetricDifference},
+	}
+
+	for _, operation := range operations {
+		fmt.Printf("# %s:\n", operation.name)
+		for _, hasher := range avl2.Hashers {
+			t1 := avl2.BuildTreeFromInorder(&b1)
+			t2 := avl2.BuildDictTreeFromInorder(&b2)
+
+			start := time.Now()
+			oldRoot := avl2.RootHash(t1, hasher, nil)
+			commitTime := time.Since(start)
+
+			start = time.Now()
+			t := operation.run(t1, t2, nil)
+			operationTime := time.Since(start)
+
+			session := avl2.NewSession()
+			start = time.Now()
+			newRoot := avl2.RootHash(t, hasher, session)
+			rehashTime := time.Since(start)
+
+			fmt.Println("hasher: ", hasher.Name())
+			fmt.Printf("old root hash: %x\n", oldRoot)
+			fmt.Printf("new root hash: %x\n", newRoot)
+			fmt.Println("time to commit the original tree: ", commitTime)
+			fmt.Println("time to run the operation: ", operationTime)
+			fmt.Println("number of re-hashes made: ", session.Stats().Hashes)
+			fmt.Println("time to re-hash: ", rehashTime)
+			fmt.Println()
+		}
+	}
+}
+
+// compareParallel times the sequential and parallel bulk operations on the same trees and checks that they agree
+func compareParallel(b1 [][]byte, b2 [][]byte, cutoff int) {
+	operations := []struct {
+		name       string
+		sequential func(T0 *avl2.Node, D *avl2.DictNode, tracker avl2.CostTracker) *avl2.Node
+		parallel   func(T0 *avl2.Node, D *avl2.DictNode, tracker avl2.CostTracker, cutoff int) *avl2.Node
+	}{
+		{"UNION", avl2.Union, avl2.ParallelUnion},
+		{"DIFFERENCE", avl2.Difference, avl2.ParallelDifference},
+	}
+
+	t1 := avl2.BuildTreeFromInorder(&b1)
+	t2 := avl2.BuildDictTreeFromInorder(&b2)
+	avl2.RootHash(t1, avl2.SHA256Hasher, nil)
+
+	fmt.Println("number of CPUs: ", runtime.GOMAXPROCS(0))
+	fmt.Println("cutoff height: ", cutoff)
+	for _, operation := range operations {
+		fmt.Println()
+		fmt.Printf("# %s:\n", operation.name)
+
+		sequentialSession := avl2.NewSession()
+		start := time.Now()
+		sequential := operation.sequential(t1, t2, sequentialSession)
+		sequentialStats := sequentialSession.Stats()
+		sequentialTime := time.Since(start)
+
+		parallelSession := avl2.NewSession()
+		start = time.Now()
+		parallel := operation.parallel(t1, t2, parallelSession, cutoff)
+		parallelStats := parallelSession.Stats()
+		parallelTime := time.Since(start)
+
+		fmt.Println("time to run the sequential operation: ", sequentialTime)
+		fmt.Println("time to run the parallel operation: ", parallelTime)
+		fmt.Printf("speedup: %.2f\n", float64(sequentialTime)/float64(parallelTime))
+		if !bytes.Equal(avl2.RootHash(sequential, avl2.SHA256Hasher, nil), avl2.RootHash(parallel, avl2.SHA256Hasher, nil)) {
+			fmt.Println("the parallel operation produced a different tree")
+		}
+		if sequentialStats != parallelStats {
+			fmt.Println("the parallel operation measured different counts")
+		}
+	}
+}
+
+// compareSequential applies the update tree to the same original tree as a bulk Union and as a sequence of single-key inserts
+// and prints their counts side by side
+func compareSequential(b1 [][]byte, b2 [][]byte, hasher avl2.Hasher) {
+	t1 := avl2.BuildTreeFromInorder(&b1)
+	t2 := avl2.BuildDictTreeFromInorder(&b2)
+	t2NodeType := (*t2).ConvertToNode()
+	avl2.RootHash(t1, hasher, nil)
+
+	bulkSession := avl2.NewSession()
+	tU := avl2.Union(t1, t2, bulkSession)
+	bulkNewNodes := bulkSession.CountNumberOfNewHashes(tU)
+
+	// One session over the whole sequence counts each original node once, however many inserts open it
+	sequentialSession := avl2.NewSession()
+	tS := t1
+	for _, key := range *(avl2.GetInorderTraversal(t2NodeType)) {
+		value, _ := avl2.Get(t2NodeType, key, nil)
+		tS = avl2.Put(tS, key, value, sequentialSession)
+	}
+	sequentialNewNodes := sequentialSession.CountNumberOfNewHashes(tS)
+
+	// Committing the tree after every insert re-hashes the path of each insert
+	committedHashes := 0
+	tC := t1
+	for _, key := range *(avl2.GetInorderTraversal(t2NodeType)) {
+		value, _ := avl2.Get(t2NodeType, key, nil)
+		session := avl2.NewSession()
+		tC = avl2.Put(tC, key, value, nil)
+		avl2.RootHash(tC, hasher, session)
+		committedHashes += session.Stats().Hashes
+	}
+
+	bulk, sequential := bulkSession.Stats(), sequentialSession.Stats()
+	fmt.Println("Number of nodes in the original tree: ", len(b1))
+	fmt.Println("Number of nodes in the update tree: ", len(b2))
+	fmt.Printf("%-45s %12s %12s\n", "", "bulk", "sequential")
+	fmt.Printf("%-45s %12d %12d\n", "number of nodes exposed", bulk.ExposedNodes, sequential.ExposedNodes)
+	fmt.Printf("%-45s %12d %12d\n", "number of nodes with height taken", bulk.HeightTakenNodes, sequential.HeightTakenNodes)
+	fmt.Printf("%-45s %12d %12d\n", "number of nodes created", bulk.CreatedNodes, sequential.CreatedNodes)
+	fmt.Printf("%-45s %12d %12d\n", "number of re-hashes to be made", bulkNewNodes, sequentialNewNodes)
+	fmt.Printf("%-45s %12d %12d\n", "number of re-hashes committing every insert", bulkNewNodes, committedHashes)
+	fmt.Printf("%-45s %12d %12d\n", "total hash count", bulk.ExposedNodes+bulkNewNodes, sequential.ExposedNodes+sequentialNewNodes)
+
+	if !bytes.Equal(avl2.RootHash(tU, hasher, nil), avl2.RootHash(tS, hasher, nil)) {
+		// Both trees hold the same keys, but the shape of an AVL tree depends on the order it was built in
+		fmt.Println("the bulk and sequential trees have different shapes")
+	}
+}
+
+// markDeletes sets the op of the entries of a dict tree whose key is in deletes
+func markDeletes(d *avl2.DictNode, deletes map[string]bool) {
+	if d == nil {
+		return
+	}
+	if deletes[string(d.Key)] {
+		d.Op = avl2.OpDelete
+	}
+	markDeletes(d.Left, deletes)
+	markDeletes(d.Right, deletes)
+}
+
+// compareApply upserts the update tree into the original tree and deletes as many of its original keys, once with a single
+// Apply and once with a Difference followed by a Union, committing the tree after each call, and prints their counts side by side
+func compareApply(b1 [][]byte, b2 [][]byte, hasher avl2.Hasher) {
+	// The deleted keys are spread evenly over the original tree
+	step := len(b1) / len(b2)
+	if step == 0 {
+		step = 1
+	}
+	upserts := make(map[string]bool)
+	for _, key := range b2 {
+		upserts[string(key)] = true
+	}
+	deletes := make(map[string]bool)
+	deleteKeys := make([][]byte, 0)
+	for i := 0; i < len(b1) && len(deleteKeys) < len(b2); i += step {
+		if !upserts[string(b1[i])] {
+			deletes[string(b1[i])] = true
+			deleteKeys = append(deleteKeys, b1[i])
+		}
+	}
+	batchKeys := append(append([][]byte{}, b2...), deleteKeys...)
+
+	t1 := avl2.BuildTreeFromInorder(&b1)
+	batch := avl2.BuildDictTreeFromInorder(&batchKeys)
+	markDeletes(batch, deletes)
+	upsertTree := avl2.BuildDictTreeFromInorder(&b2)
+	deleteTree := avl2.BuildDictTreeFromInorder(&deleteKeys)
+	avl2.RootHash(t1, hasher, nil)
+
+	applySession := avl2.NewSession()
+	tA := avl2.Apply(t1, batch, applySession)
+	avl2.RootHash(tA, hasher, applySession)
+
+	differenceSession := avl2.NewSession()
+	tD := avl2.Difference(t1, deleteTree, differenceSession)
+	avl2.RootHash(tD, hasher, differenceSession)
+	unionSession := avl2.NewSession()
+	tU := avl2.Union(tD, upsertTree, unionSession)
+	avl2.RootHash(tU, hasher, unionSession)
+
+	apply, difference, union := applySession.Stats(), differenceSession.Stats(), unionSession.Stats()
+	fmt.Println("Number of nodes in the original tree: ", len(b1))
+	fmt.Println("Number of upserts in the batch: ", len(b2))
+	fmt.Println("Number of deletes in the batch: ", len(deleteKeys))
+	fmt.Printf("%-45s %12s %18s\n", "", "apply", "difference+union")
+	fmt.Printf("%-45s %12d %18d\n", "number of nodes exposed", apply.ExposedNodes, difference.ExposedNodes+union.ExposedNodes)
+	fmt.Printf("%-45s %12d %18d\n", "number of nodes with height taken", apply.HeightTakenNodes, difference.HeightTakenNodes+union.HeightTakenNodes)
+	fmt.Printf("%-45s %12d %18d\n", "number of nodes created", apply.CreatedNodes, difference.CreatedNodes+union.CreatedNodes)
+	fmt.Printf("%-45s %12d %18d\n", "number of splits", apply.Splits, difference.Splits+union.Splits)
+	fmt.Printf("%-45s %12d %18d\n", "number of joins", apply.Joins, difference.Joins+union.Joins)
+	fmt.Printf("%-45s %12d %18d\n", "number of re-hashes made", apply.Hashes, difference.Hashes+union.Hashes)
+
+	if len(*(avl2.GetInorderTraversal(tA))) != len(*(avl2.GetInorderTraversal(tU))) {
+		fmt.Println("apply and difference+union produced different key sets")
+	}
+}
+
+// compareCompose spreads the update tree over the transactions of a block, each also writing to a key shared by all of
+// them, and applies the block once transaction by transaction, committing the tree after each, and once as the
+// composition of the transactions' batches, printing their counts side by side
+func compareCompose(b1 [][]byte, b2 [][]byte, hasher avl2.Hasher) {
+	const transactions = 10
+	batches := make([]*avl2.DictNode, transactions)
+	for i := range batches {
+		builder := avl2.NewBatchBuilder()
+		builder.Put(b2[0], []byte{byte(i)})
+		for j := i; j < len(b2); j += transactions {
+			builder.Put(b2[j], []byte{byte(i)})
+		}
+		batches[i] = builder.Build()
+	}
+
+	t1 := avl2.BuildTreeFromInorder(&b1)
+	avl2.RootHash(t1, hasher, nil)
+
+	var sequential avl2.Stats
+	tS := t1
+	for _, batch := range batches {
+		session := avl2.NewSession()
+		tS = avl2.Apply(tS, batch, session)
+		avl2.RootHash(tS, hasher, session)
+		stats := session.Stats()
+		sequential.ExposedNodes += stats.ExposedNodes
+		sequential.HeightTakenNodes += stats.HeightTakenNodes
+		sequential.CreatedNodes += stats.CreatedNodes
+		sequential.Splits += stats.Splits
+		sequential.Joins += stats.Joins
+		sequential.Hashes += stats.Hashes
+	}
+
+	block := batches[0]
+	for _, batch := range batches[1:] {
+		block = avl2.ComposeBatches(block, batch)
+	}
+	session := avl2.NewSession()
+	tC := avl2.Apply(t1, block, session)
+	avl2.RootHash(tC, hasher, session)
+	composed := session.Stats()
+
+	fmt.Println("Number of nodes in the original tree: ", len(b1))
+	fmt.Println("Number of keys written by the block: ", len(b2))
+	fmt.Println("Number of transactions in the block: ", transactions)
+	fmt.Printf("%-45s %14s %12s\n", "", "transactions", "composed")
+	fmt.Printf("%-45s %14d %12d\n", "number of nodes exposed", sequential.ExposedNodes, composed.ExposedNodes)
+	fmt.Printf("%-45s %14d %12d\n", "number of nodes with height taken", sequential.HeightTakenNodes, composed.HeightTakenNodes)
+	fmt.Printf("%-45s %14d %12d\n", "number of nodes created", sequential.CreatedNodes, composed.CreatedNodes)
+	fmt.Printf("%-45s %14d %12d\n", "number of splits", sequential.Splits, composed.Splits)
+	fmt.Printf("%-45s %14d %12d\n", "number of joins", sequential.Joins, composed.Joins)
+	fmt.Printf("%-45s %14d %12d\n", "number of re-hashes made", sequential.Hashes, composed.Hashes)
+
+	for _, key := range b2 {
+		vS, _ := avl2.Get(tS, key, nil)
+		vC, _ := avl2.Get(tC, key, nil)
+		if !bytes.Equal(vS, vC) {
+			fmt.Println("the transactions and the composed block disagree on key: ", key)
+			return
+		}
+	}
+}